@@ -0,0 +1,525 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+const (
+	// numAlgorithms is the number of algorithms of the DX7.
+	numAlgorithms = 32
+
+	// numOps is the number of operators of the DX7.
+	numOps = 6
+)
+
+// algorithmName is the pattern that the names of
+// user-defined algorithms must match.
+var algorithmName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Mod is a modulation routing from one operator to another.
+type Mod struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Algorithm describes how the operators of a voice
+// are connected to one another.
+// Operators are numbered from 1 to NumOps.
+type Algorithm struct {
+	// Name identifies the algorithm.
+	// The DX7 algorithms are named 1 to 32.
+	Name string `json:"name"`
+
+	// NumOps is the number of operators.
+	NumOps int `json:"ops"`
+
+	// Mods lists the operators that modulate other operators.
+	Mods []Mod `json:"mods"`
+
+	// Carriers lists the operators that are heard.
+	Carriers []int `json:"carriers"`
+
+	// Feedback is the routing that is controlled by the feedback
+	// parameter of a voice. For most algorithms an operator
+	// modulates itself, but for algorithms 4 and 6 the feedback
+	// loop spans several operators.
+	// The output of Feedback.From modulates Feedback.To.
+	// If From is 0 the algorithm has no feedback.
+	Feedback Mod `json:"feedback"`
+}
+
+// algorithms is the routing table for the 32 DX7 algorithms,
+// as printed on the front panel of the DX7.
+// The algorithm for algorithm number n is at index n-1.
+// Their names and number of operators are set by init.
+var algorithms = [numAlgorithms]Algorithm{
+	{ // 1
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 4}, {6, 5}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{6, 6},
+	},
+	{ // 2
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 4}, {6, 5}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{2, 2},
+	},
+	{ // 3
+		Mods:     []Mod{{2, 1}, {3, 2}, {5, 4}, {6, 5}},
+		Carriers: []int{1, 4},
+		Feedback: Mod{6, 6},
+	},
+	{ // 4
+		Mods:     []Mod{{2, 1}, {3, 2}, {5, 4}, {6, 5}},
+		Carriers: []int{1, 4},
+		Feedback: Mod{4, 6},
+	},
+	{ // 5
+		Mods:     []Mod{{2, 1}, {4, 3}, {6, 5}},
+		Carriers: []int{1, 3, 5},
+		Feedback: Mod{6, 6},
+	},
+	{ // 6
+		Mods:     []Mod{{2, 1}, {4, 3}, {6, 5}},
+		Carriers: []int{1, 3, 5},
+		Feedback: Mod{5, 6},
+	},
+	{ // 7
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 3}, {6, 5}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{6, 6},
+	},
+	{ // 8
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 3}, {6, 5}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{4, 4},
+	},
+	{ // 9
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 3}, {6, 5}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{2, 2},
+	},
+	{ // 10
+		Mods:     []Mod{{2, 1}, {3, 2}, {5, 4}, {6, 4}},
+		Carriers: []int{1, 4},
+		Feedback: Mod{3, 3},
+	},
+	{ // 11
+		Mods:     []Mod{{2, 1}, {3, 2}, {5, 4}, {6, 4}},
+		Carriers: []int{1, 4},
+		Feedback: Mod{6, 6},
+	},
+	{ // 12
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 3}, {6, 3}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{2, 2},
+	},
+	{ // 13
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 3}, {6, 3}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{6, 6},
+	},
+	{ // 14
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 4}, {6, 4}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{6, 6},
+	},
+	{ // 15
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 4}, {6, 4}},
+		Carriers: []int{1, 3},
+		Feedback: Mod{2, 2},
+	},
+	{ // 16
+		Mods:     []Mod{{2, 1}, {3, 1}, {4, 3}, {5, 1}, {6, 5}},
+		Carriers: []int{1},
+		Feedback: Mod{6, 6},
+	},
+	{ // 17
+		Mods:     []Mod{{2, 1}, {3, 1}, {4, 3}, {5, 1}, {6, 5}},
+		Carriers: []int{1},
+		Feedback: Mod{2, 2},
+	},
+	{ // 18
+		Mods:     []Mod{{2, 1}, {3, 1}, {4, 1}, {5, 4}, {6, 5}},
+		Carriers: []int{1},
+		Feedback: Mod{3, 3},
+	},
+	{ // 19
+		Mods:     []Mod{{2, 1}, {3, 2}, {6, 4}, {6, 5}},
+		Carriers: []int{1, 4, 5},
+		Feedback: Mod{6, 6},
+	},
+	{ // 20
+		Mods:     []Mod{{3, 1}, {3, 2}, {5, 4}, {6, 4}},
+		Carriers: []int{1, 2, 4},
+		Feedback: Mod{3, 3},
+	},
+	{ // 21
+		Mods:     []Mod{{3, 1}, {3, 2}, {6, 4}, {6, 5}},
+		Carriers: []int{1, 2, 4, 5},
+		Feedback: Mod{3, 3},
+	},
+	{ // 22
+		Mods:     []Mod{{2, 1}, {6, 3}, {6, 4}, {6, 5}},
+		Carriers: []int{1, 3, 4, 5},
+		Feedback: Mod{6, 6},
+	},
+	{ // 23
+		Mods:     []Mod{{3, 2}, {6, 4}, {6, 5}},
+		Carriers: []int{1, 2, 4, 5},
+		Feedback: Mod{6, 6},
+	},
+	{ // 24
+		Mods:     []Mod{{6, 3}, {6, 4}, {6, 5}},
+		Carriers: []int{1, 2, 3, 4, 5},
+		Feedback: Mod{6, 6},
+	},
+	{ // 25
+		Mods:     []Mod{{6, 4}, {6, 5}},
+		Carriers: []int{1, 2, 3, 4, 5},
+		Feedback: Mod{6, 6},
+	},
+	{ // 26
+		Mods:     []Mod{{3, 2}, {5, 4}, {6, 4}},
+		Carriers: []int{1, 2, 4},
+		Feedback: Mod{6, 6},
+	},
+	{ // 27
+		Mods:     []Mod{{3, 2}, {5, 4}, {6, 4}},
+		Carriers: []int{1, 2, 4},
+		Feedback: Mod{3, 3},
+	},
+	{ // 28
+		Mods:     []Mod{{2, 1}, {4, 3}, {5, 4}},
+		Carriers: []int{1, 3, 6},
+		Feedback: Mod{5, 5},
+	},
+	{ // 29
+		Mods:     []Mod{{4, 3}, {6, 5}},
+		Carriers: []int{1, 2, 3, 5},
+		Feedback: Mod{6, 6},
+	},
+	{ // 30
+		Mods:     []Mod{{4, 3}, {5, 4}},
+		Carriers: []int{1, 2, 3, 6},
+		Feedback: Mod{5, 5},
+	},
+	{ // 31
+		Mods:     []Mod{{6, 5}},
+		Carriers: []int{1, 2, 3, 4, 5},
+		Feedback: Mod{6, 6},
+	},
+	{ // 32
+		Carriers: []int{1, 2, 3, 4, 5, 6},
+		Feedback: Mod{6, 6},
+	},
+}
+
+func init() {
+	for i := range algorithms {
+		algorithms[i].Name = strconv.Itoa(i + 1)
+		algorithms[i].NumOps = numOps
+	}
+}
+
+// ReadAlgorithms reads a JSON array of user-defined algorithms.
+// Every algorithm is validated.
+func ReadAlgorithms(r io.Reader) ([]Algorithm, error) {
+	var algos []Algorithm
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&algos); err != nil {
+		return nil, errors.Wrap(err, "decoding algorithms")
+	}
+	for _, algo := range algos {
+		if !algorithmName.MatchString(algo.Name) {
+			return nil, errors.Errorf("invalid algorithm name %q", algo.Name)
+		}
+		if err := algo.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return algos, nil
+}
+
+// Validate checks that the algorithm can be turned into a synthdef.
+// Every operator must be in range, the modulation graph must
+// not have cycles, and every operator must be heard either as
+// a carrier or by modulating an operator that is heard.
+func (algo Algorithm) Validate() error {
+	if algo.NumOps < 1 {
+		return errors.Errorf("algorithm %s: needs at least 1 operator", algo.Name)
+	}
+	inRange := func(op int) bool {
+		return op >= 1 && op <= algo.NumOps
+	}
+	if len(algo.Carriers) == 0 {
+		return errors.Errorf("algorithm %s: has no carriers", algo.Name)
+	}
+	carriers := map[int]bool{}
+	for _, op := range algo.Carriers {
+		if !inRange(op) {
+			return errors.Errorf("algorithm %s: carrier op%d is out of range [1, %d]", algo.Name, op, algo.NumOps)
+		}
+		if carriers[op] {
+			return errors.Errorf("algorithm %s: op%d is a carrier twice", algo.Name, op)
+		}
+		carriers[op] = true
+	}
+	for _, mod := range algo.Mods {
+		if !inRange(mod.From) || !inRange(mod.To) {
+			return errors.Errorf("algorithm %s: op%d -> op%d is out of range [1, %d]", algo.Name, mod.From, mod.To, algo.NumOps)
+		}
+		if mod.From == mod.To {
+			return errors.Errorf("algorithm %s: op%d modulates itself, use feedback instead", algo.Name, mod.From)
+		}
+	}
+	if fb := algo.Feedback; fb.From != 0 || fb.To != 0 {
+		if !inRange(fb.From) || !inRange(fb.To) {
+			return errors.Errorf("algorithm %s: feedback op%d -> op%d is out of range [1, %d]", algo.Name, fb.From, fb.To, algo.NumOps)
+		}
+	}
+	if cycle := algo.cycle(); cycle != nil {
+		names := make([]string, len(cycle))
+		for i, op := range cycle {
+			names[i] = "op" + strconv.Itoa(op)
+		}
+		return errors.Errorf("algorithm %s: modulation cycle %s", algo.Name, strings.Join(names, " -> "))
+	}
+	// Walk the graph backwards from the carriers.
+	var (
+		heard = map[int]bool{}
+		queue = append([]int{}, algo.Carriers...)
+	)
+	for len(queue) > 0 {
+		op := queue[0]
+		queue = queue[1:]
+		if heard[op] {
+			continue
+		}
+		heard[op] = true
+		queue = append(queue, algo.modulators(op)...)
+	}
+	for op := 1; op <= algo.NumOps; op++ {
+		if !heard[op] {
+			return errors.Errorf("algorithm %s: op%d does not reach a carrier", algo.Name, op)
+		}
+	}
+	return nil
+}
+
+// cycle returns a modulation cycle of the algorithm, starting
+// and ending with the same operator, or nil if there is none.
+func (algo Algorithm) cycle() []int {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	var (
+		state = make([]int, algo.NumOps+1)
+		path  []int
+		visit func(op int) []int
+	)
+	visit = func(op int) []int {
+		state[op] = visiting
+		path = append(path, op)
+
+		for _, mod := range algo.Mods {
+			if mod.From != op {
+				continue
+			}
+			switch state[mod.To] {
+			case visiting:
+				for i, p := range path {
+					if p == mod.To {
+						return append(append([]int{}, path[i:]...), mod.To)
+					}
+				}
+			case unvisited:
+				if cycle := visit(mod.To); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[op] = done
+		return nil
+	}
+	for op := 1; op <= algo.NumOps; op++ {
+		if state[op] == unvisited {
+			if cycle := visit(op); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// modulators returns the operators that modulate op, in ascending order.
+func (algo Algorithm) modulators(op int) []int {
+	var mods []int
+	for _, mod := range algo.Mods {
+		if mod.To == op {
+			mods = append(mods, mod.From)
+		}
+	}
+	sort.Ints(mods)
+	return mods
+}
+
+// order returns the operators in the order their ugens are created,
+// which puts every operator after its modulators.
+// Of the operators whose modulators have been created, the one with
+// the highest number comes first.
+// The algorithm must not have modulation cycles.
+func (algo Algorithm) order() []int {
+	var (
+		created = map[int]bool{}
+		order   = make([]int, 0, algo.NumOps)
+	)
+	for len(order) < algo.NumOps {
+		for op := algo.NumOps; op > 0; op-- {
+			if created[op] {
+				continue
+			}
+			ready := true
+			for _, mod := range algo.modulators(op) {
+				if !created[mod] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				created[op] = true
+				order = append(order, op)
+				break
+			}
+		}
+	}
+	return order
+}
+
+// DefName returns the name of the synthdef for the algorithm.
+func (algo Algorithm) DefName() string {
+	return "dx7_algo" + algo.Name
+}
+
+// UgenFunc returns a function that creates the ugen graph of the algorithm.
+// The amount of feedback is controlled by the "feedback" param (in radians).
+// The feedback loop goes through LocalIn and LocalOut, so the fed
+// back signal is one control block (64 samples by default) late,
+// where the DX7 delays it by one sample. Feedback therefore does
+// not sound like the hardware in any algorithm, including the
+// loops over several operators of algorithms 4 and 6.
+// The algorithm must be valid.
+func (algo Algorithm) UgenFunc() sc.UgenFunc {
+	return func(p sc.Params) sc.Ugen {
+		var (
+			gate     = p.Add("gate", 1)
+			feedback = p.Add("feedback", 0)
+			mod      = voiceMod(p, gate)
+			bus      = sc.C(0)
+			fb       = algo.Feedback
+			outputs  = map[int]sc.Input{}
+			egs      = make([]sc.Input, 0, algo.NumOps)
+		)
+		// Every feedback routing, including an operator that feeds
+		// back its own output, is a loop that goes through LocalIn
+		// and LocalOut, so the fed back signal modulates the phase
+		// of a SinOsc like any other modulator does.
+		// A synthdef can not delay a signal by less than a control
+		// block, short of running the whole server with a block
+		// size of 1.
+		var fbIn sc.Input
+		if fb.From != 0 {
+			fbIn = localIn()
+		}
+		for _, op := range algo.order() {
+			var fm sc.Input
+
+			if mods := algo.modulators(op); len(mods) > 0 {
+				inputs := make([]sc.Input, len(mods))
+				for i, mod := range mods {
+					inputs[i] = outputs[mod]
+				}
+				fm = sc.Mix(sc.AR, inputs)
+			}
+			o := newOperator(op, p, gate, mod, fm)
+			if fb.From != 0 && op == fb.To {
+				o.Feedback = feedback
+				o.FeedbackIn = fbIn
+			}
+			out, eg := o.ugens(sc.AR)
+			outputs[op] = out
+			egs = append(egs, eg)
+		}
+		carriers := make([]sc.Input, len(algo.Carriers))
+		for i, op := range algo.Carriers {
+			carriers[i] = outputs[op]
+		}
+		sig := sc.Mix(sc.AR, carriers).Mul(p.Add("amp", voiceDefaults["amp"]))
+		// The synth is freed when the envelopes of all the
+		// operators have finished their release.
+		var (
+			free     = freeWhenDone(egs...)
+			channels = sc.Multi(sig, sig, free)
+		)
+		if fbIn != nil {
+			channels = sc.Multi(sig, sig, localOut(outputs[fb.From]), free)
+		}
+		return sc.Out{Bus: bus, Channels: channels}.Rate(sc.AR)
+	}
+}
+
+// localIn creates a LocalIn ugen that reads one audio channel
+// from the LocalOut of the same synth.
+func localIn() sc.Input {
+	return sc.NewInput("LocalIn", sc.AR, 0, 1, sc.C(0))
+}
+
+// localOut creates a LocalOut ugen that writes a signal to the
+// LocalIn of the same synth.
+// LocalOut has no outputs, so adding it to the channels of an
+// Out ugen makes it part of the synthdef without adding any
+// inputs to the Out ugen.
+func localOut(in sc.Input) sc.Input {
+	u := sc.NewUgen("LocalOut", sc.AR, 0, 1, in)
+	u.NumOutputs = 0
+	return u
+}
+
+// freeWhenDone creates a FreeSelf ugen that frees the synth once
+// all the envelope generators are done.
+// Like LocalOut it has no outputs, so it can be added to the
+// channels of an Out ugen.
+func freeWhenDone(egs ...sc.Input) sc.Input {
+	done := envDone(egs[0])
+	for _, eg := range egs[1:] {
+		done = done.Mul(envDone(eg))
+	}
+	u := sc.NewUgen("FreeSelf", sc.KR, 0, 1, done)
+	u.NumOutputs = 0
+	return u
+}
+
+// envDone creates a Done ugen that is 1 once an envelope
+// generator has finished, and 0 before.
+func envDone(eg sc.Input) sc.Input {
+	return sc.NewInput("Done", sc.KR, 0, 1, eg)
+}
+
+// defName returns the name of the synthdef for a DX7 algorithm number (1-32).
+func defName(algo int) string {
+	return fmt.Sprintf("dx7_algo%d", algo)
+}
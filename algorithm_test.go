@@ -0,0 +1,466 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/scgolang/sc"
+)
+
+// numCarriers is the number of carriers of every algorithm
+// according to the DX7 algorithm chart.
+var numCarriers = [numAlgorithms]int{
+	2, 2, 2, 2, 3, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1,
+	1, 1, 3, 3, 4, 4, 4, 5, 5, 3, 3, 3, 4, 4, 5, 6,
+}
+
+// chartDefs are synthdefs for some of the algorithms that
+// were written by hand from the DX7 algorithm chart.
+var chartDefs = map[int]sc.UgenFunc{
+	1: func(p sc.Params) sc.Ugen {
+		gate, fb, bus := p.Add("gate", 1), p.Add("feedback", 0), sc.C(0)
+		mod := voiceMod(p, gate)
+		op6, eg6 := feedbackOperator(6, p, gate, mod, fb)
+		op5, eg5 := NewOperator(5, p, gate, mod, op6)
+		op4, eg4 := NewOperator(4, p, gate, mod, op5)
+		op3, eg3 := NewOperator(3, p, gate, mod, op4)
+		op2, eg2 := NewOperator(2, p, gate, mod, nil)
+		op1, eg1 := NewOperator(1, p, gate, mod, op2)
+		sig := op1.Add(op3).Mul(p.Add("amp", voiceDefaults["amp"]))
+		sig = sc.Multi(sig, sig, localOut(op6), freeWhenDone(eg6, eg5, eg4, eg3, eg2, eg1))
+		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
+	},
+	3: func(p sc.Params) sc.Ugen {
+		gate, fb, bus := p.Add("gate", 1), p.Add("feedback", 0), sc.C(0)
+		mod := voiceMod(p, gate)
+		op6, eg6 := feedbackOperator(6, p, gate, mod, fb)
+		op5, eg5 := NewOperator(5, p, gate, mod, op6)
+		op4, eg4 := NewOperator(4, p, gate, mod, op5)
+		op3, eg3 := NewOperator(3, p, gate, mod, nil)
+		op2, eg2 := NewOperator(2, p, gate, mod, op3)
+		op1, eg1 := NewOperator(1, p, gate, mod, op2)
+		sig := op1.Add(op4).Mul(p.Add("amp", voiceDefaults["amp"]))
+		sig = sc.Multi(sig, sig, localOut(op6), freeWhenDone(eg6, eg5, eg4, eg3, eg2, eg1))
+		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
+	},
+	5: func(p sc.Params) sc.Ugen {
+		gate, fb, bus := p.Add("gate", 1), p.Add("feedback", 0), sc.C(0)
+		mod := voiceMod(p, gate)
+		op6, eg6 := feedbackOperator(6, p, gate, mod, fb)
+		op5, eg5 := NewOperator(5, p, gate, mod, op6)
+		op4, eg4 := NewOperator(4, p, gate, mod, nil)
+		op3, eg3 := NewOperator(3, p, gate, mod, op4)
+		op2, eg2 := NewOperator(2, p, gate, mod, nil)
+		op1, eg1 := NewOperator(1, p, gate, mod, op2)
+		sig := sc.Mix(sc.AR, []sc.Input{op1, op3, op5}).Mul(p.Add("amp", voiceDefaults["amp"]))
+		sig = sc.Multi(sig, sig, localOut(op6), freeWhenDone(eg6, eg5, eg4, eg3, eg2, eg1))
+		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
+	},
+	16: func(p sc.Params) sc.Ugen {
+		gate, fb, bus := p.Add("gate", 1), p.Add("feedback", 0), sc.C(0)
+		mod := voiceMod(p, gate)
+		op6, eg6 := feedbackOperator(6, p, gate, mod, fb)
+		op5, eg5 := NewOperator(5, p, gate, mod, op6)
+		op4, eg4 := NewOperator(4, p, gate, mod, nil)
+		op3, eg3 := NewOperator(3, p, gate, mod, op4)
+		op2, eg2 := NewOperator(2, p, gate, mod, nil)
+		op1, eg1 := NewOperator(1, p, gate, mod, sc.Mix(sc.AR, []sc.Input{op2, op3, op5}))
+		sig := op1.Mul(p.Add("amp", voiceDefaults["amp"]))
+		sig = sc.Multi(sig, sig, localOut(op6), freeWhenDone(eg6, eg5, eg4, eg3, eg2, eg1))
+		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
+	},
+	23: func(p sc.Params) sc.Ugen {
+		gate, fb, bus := p.Add("gate", 1), p.Add("feedback", 0), sc.C(0)
+		mod := voiceMod(p, gate)
+		op6, eg6 := feedbackOperator(6, p, gate, mod, fb)
+		op5, eg5 := NewOperator(5, p, gate, mod, op6)
+		op4, eg4 := NewOperator(4, p, gate, mod, op6)
+		op3, eg3 := NewOperator(3, p, gate, mod, nil)
+		op2, eg2 := NewOperator(2, p, gate, mod, op3)
+		op1, eg1 := NewOperator(1, p, gate, mod, nil)
+		sig := sc.Mix(sc.AR, []sc.Input{op1, op2, op4, op5}).Mul(p.Add("amp", voiceDefaults["amp"]))
+		sig = sc.Multi(sig, sig, localOut(op6), freeWhenDone(eg6, eg5, eg4, eg3, eg2, eg1))
+		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
+	},
+	32: func(p sc.Params) sc.Ugen {
+		gate, fb, bus := p.Add("gate", 1), p.Add("feedback", 0), sc.C(0)
+		mod := voiceMod(p, gate)
+		op6, eg6 := feedbackOperator(6, p, gate, mod, fb)
+		op5, eg5 := NewOperator(5, p, gate, mod, nil)
+		op4, eg4 := NewOperator(4, p, gate, mod, nil)
+		op3, eg3 := NewOperator(3, p, gate, mod, nil)
+		op2, eg2 := NewOperator(2, p, gate, mod, nil)
+		op1, eg1 := NewOperator(1, p, gate, mod, nil)
+		sig := sc.Mix(sc.AR, []sc.Input{op1, op2, op3, op4, op5, op6}).Mul(p.Add("amp", voiceDefaults["amp"]))
+		sig = sc.Multi(sig, sig, localOut(op6), freeWhenDone(eg6, eg5, eg4, eg3, eg2, eg1))
+		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
+	},
+}
+
+// feedbackOperator creates an operator that feeds back its own
+// output, which has to be written to a LocalOut.
+func feedbackOperator(i int, p sc.Params, gate sc.Input, mod VoiceMod, fb sc.Input) (out, eg sc.Input) {
+	op := newOperator(i, p, gate, mod, nil)
+	op.Feedback = fb
+	op.FeedbackIn = localIn()
+	return op.ugens(sc.AR)
+}
+
+func TestAlgorithms(t *testing.T) {
+	for i, algo := range algorithms {
+		n := i + 1
+
+		if expected, got := numCarriers[i], len(algo.Carriers); expected != got {
+			t.Fatalf("algorithm %d: expected %d carriers, got %d", n, expected, got)
+		}
+		// Every operator is either a carrier or modulates
+		// exactly one chain of operators below it.
+		used := map[int]bool{}
+		for _, op := range algo.Carriers {
+			if used[op] {
+				t.Fatalf("algorithm %d: op%d is a carrier twice", n, op)
+			}
+			used[op] = true
+		}
+		for _, mod := range algo.Mods {
+			if mod.From <= mod.To {
+				t.Fatalf("algorithm %d: op%d can not modulate op%d", n, mod.From, mod.To)
+			}
+			if mod.To < 1 || mod.From > numOps {
+				t.Fatalf("algorithm %d: op%d -> op%d is out of range", n, mod.From, mod.To)
+			}
+			used[mod.From] = true
+		}
+		for op := 1; op <= numOps; op++ {
+			if !used[op] {
+				t.Fatalf("algorithm %d: op%d is not used", n, op)
+			}
+		}
+		fb := algo.Feedback
+		if fb.From < 1 || fb.From > numOps || fb.To < fb.From || fb.To > numOps {
+			t.Fatalf("algorithm %d: bad feedback routing %v", n, fb)
+		}
+	}
+}
+
+func TestAlgorithmSynthdefs(t *testing.T) {
+	for i := range algorithms {
+		n := i + 1
+
+		name, err := getDefName(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			def    = sc.NewSynthdef(name, synthdefs[name])
+			counts = map[string]int{}
+		)
+		// Only count audio rate ugens, the LFO has a control rate SinOsc.
+		for _, ugen := range def.Ugens {
+			if ugen.Rate == sc.AR {
+				counts[ugen.Name]++
+			}
+		}
+		if expected, got := numOps, counts["SinOsc"]; expected != got {
+			t.Fatalf("algorithm %d: expected %d oscillators, got %d", n, expected, got)
+		}
+		// Every algorithm has one feedback loop, whether it spans
+		// several operators or an operator modulates itself.
+		if expected, got := 1, counts["LocalIn"]; expected != got {
+			t.Fatalf("algorithm %d: expected %d LocalIn, got %d", n, expected, got)
+		}
+		if expected, got := 1, counts["LocalOut"]; expected != got {
+			t.Fatalf("algorithm %d: expected %d LocalOut, got %d", n, expected, got)
+		}
+		// Every operator has its own release, so no envelope frees
+		// the synth. It is freed once all of them are done.
+		for _, ugen := range def.Ugens {
+			if ugen.Name != "EnvGen" || ugen.Rate != sc.AR {
+				continue
+			}
+			if done := ugen.Inputs[4]; !done.IsConstant() || def.Constants[done.OutputIndex] != sc.DoNothing {
+				t.Fatalf("algorithm %d: expected operator envelopes to do nothing when done", n)
+			}
+		}
+		var dones, frees int
+		for _, ugen := range def.Ugens {
+			switch ugen.Name {
+			case "Done":
+				dones++
+			case "FreeSelf":
+				frees++
+			}
+		}
+		if expected, got := numOps, dones; expected != got {
+			t.Fatalf("algorithm %d: expected %d Done, got %d", n, expected, got)
+		}
+		if expected, got := 1, frees; expected != got {
+			t.Fatalf("algorithm %d: expected %d FreeSelf, got %d", n, expected, got)
+		}
+		out := def.Ugens[len(def.Ugens)-1]
+		if expected, got := "Out", out.Name; expected != got {
+			t.Fatalf("algorithm %d: expected root %s, got %s", n, expected, got)
+		}
+		if expected, got := 3, len(out.Inputs); expected != got {
+			t.Fatalf("algorithm %d: expected %d Out inputs, got %d", n, expected, got)
+		}
+	}
+	for _, n := range []int{0, 33} {
+		if _, err := getDefName(n); err == nil {
+			t.Fatalf("expected error for algorithm %d", n)
+		}
+	}
+}
+
+func TestFeedbackLoopRate(t *testing.T) {
+	for i, algo := range algorithms {
+		var (
+			n   = i + 1
+			def = sc.NewSynthdef(algo.DefName(), algo.UgenFunc())
+			fed = 0
+		)
+		// The fed back signal is audio rate, so the phase of every
+		// oscillator it reaches has to be audio rate too.
+		for _, ugen := range def.Ugens {
+			if ugen.Name != "SinOsc" || ugen.Rate != sc.AR {
+				continue
+			}
+			phase := ugen.Inputs[1]
+			if !dependsOn(def, phase, "LocalIn") {
+				continue
+			}
+			fed++
+
+			if expected, got := int8(sc.AR), def.Ugens[phase.UgenIndex].Rate; expected != got {
+				t.Fatalf("algorithm %d: expected phase at rate %d, got %d", n, expected, got)
+			}
+		}
+		if fed == 0 {
+			t.Fatalf("algorithm %d: expected the feedback to reach an oscillator", n)
+		}
+	}
+}
+
+func TestFeedbackDelay(t *testing.T) {
+	for i, algo := range algorithms {
+		var (
+			n    = i + 1
+			def  = sc.NewSynthdef(algo.DefName(), algo.UgenFunc())
+			outs = findUgens(def, "LocalOut")
+		)
+		// The loop is closed by LocalOut writing the output of an
+		// operator that reads LocalIn, so the fed back signal is
+		// delayed by one control block rather than one sample.
+		if expected, got := 1, len(outs); expected != got {
+			t.Fatalf("algorithm %d: expected %d LocalOut, got %d", n, expected, got)
+		}
+		out := def.Ugens[outs[0].UgenIndex]
+		if !dependsOn(def, out.Inputs[0], "LocalIn") {
+			t.Fatalf("algorithm %d: expected the feedback loop to go through LocalIn and LocalOut", n)
+		}
+		if expected, got := int8(sc.AR), out.Rate; expected != got {
+			t.Fatalf("algorithm %d: expected LocalOut at rate %d, got %d", n, expected, got)
+		}
+	}
+}
+
+func TestSelfFeedbackPhase(t *testing.T) {
+	for i, algo := range algorithms {
+		fb := algo.Feedback
+		if fb.From != fb.To {
+			continue
+		}
+		var (
+			n     = i + 1
+			def   = sc.NewSynthdef(algo.DefName(), algo.UgenFunc())
+			phase = paramInput(t, def, "op"+strconv.Itoa(fb.To)+"phase")
+			fed   = 0
+		)
+		// The operator that modulates itself is the only one that
+		// is fed back without being modulated by another operator.
+		// It starts at its phase param like every other operator.
+		for _, ugen := range def.Ugens {
+			if ugen.Name != "SinOsc" || ugen.Rate != sc.AR {
+				continue
+			}
+			if in := ugen.Inputs[1]; !dependsOn(def, in, "LocalIn") || dependsOn(def, in, "SinOsc") {
+				continue
+			}
+			fed++
+
+			if !readsInput(def, ugen.Inputs[1], phase) {
+				t.Fatalf("algorithm %d: expected the phase of op%d to read its phase param", n, fb.To)
+			}
+		}
+		if expected, got := 1, fed; expected != got {
+			t.Fatalf("algorithm %d: expected the feedback to reach %d oscillator, got %d", n, expected, got)
+		}
+	}
+}
+
+// readsInput reports whether a synthdef input is computed from another input.
+func readsInput(def *sc.Synthdef, in, target sc.UgenInput) bool {
+	if in == target {
+		return true
+	}
+	if in.IsConstant() {
+		return false
+	}
+	for _, input := range def.Ugens[in.UgenIndex].Inputs {
+		if readsInput(def, input, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependsOn reports whether a synthdef input is computed from a ugen with a name.
+func dependsOn(def *sc.Synthdef, in sc.UgenInput, name string) bool {
+	if in.IsConstant() {
+		return false
+	}
+	ugen := def.Ugens[in.UgenIndex]
+	if ugen.Name == name {
+		return true
+	}
+	for _, input := range ugen.Inputs {
+		if dependsOn(def, input, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAlgorithmsMatchChart(t *testing.T) {
+	for n, f := range chartDefs {
+		var (
+			name     = defName(n)
+			expected = sc.NewSynthdef(name, f)
+			got      = sc.NewSynthdef(name, algorithms[n-1].UgenFunc())
+		)
+		same, err := expected.CompareToDef(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !same {
+			t.Fatalf("algorithm %d does not match the chart: %v", n, expected.Diff(got))
+		}
+	}
+}
+
+func TestReadAlgorithms(t *testing.T) {
+	f, err := os.Open("assets/algorithms/stacks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	algos, err := ReadAlgorithms(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, len(algos); expected != got {
+		t.Fatalf("expected %d algorithms, got %d", expected, got)
+	}
+	for i, numOps := range []int{8, 12} {
+		algo := algos[i]
+		if expected, got := numOps, algo.NumOps; expected != got {
+			t.Fatalf("algorithm %s: expected %d ops, got %d", algo.Name, expected, got)
+		}
+		var (
+			def    = sc.NewSynthdef(algo.DefName(), algo.UgenFunc())
+			counts = map[string]int{}
+		)
+		// Only count audio rate ugens, the LFO has a control rate SinOsc.
+		for _, ugen := range def.Ugens {
+			if ugen.Rate == sc.AR {
+				counts[ugen.Name]++
+			}
+		}
+		if expected, got := numOps, counts["SinOsc"]; expected != got {
+			t.Fatalf("algorithm %s: expected %d oscillators, got %d", algo.Name, expected, got)
+		}
+	}
+}
+
+func TestReadAlgorithmsErrors(t *testing.T) {
+	for _, testcase := range []struct {
+		input string
+		err   string
+	}{
+		{
+			input: `[{"name": "a b", "ops": 1, "carriers": [1]}]`,
+			err:   `invalid algorithm name "a b"`,
+		},
+		{
+			input: `[{"name": "a", "ops": 1, "carriers": [1], "modulators": []}]`,
+			err:   `decoding algorithms: json: unknown field "modulators"`,
+		},
+		{
+			input: `[{"name": "a", "ops": 0, "carriers": [1]}]`,
+			err:   `algorithm a: needs at least 1 operator`,
+		},
+		{
+			input: `[{"name": "a", "ops": 2, "mods": [{"from": 2, "to": 1}]}]`,
+			err:   `algorithm a: has no carriers`,
+		},
+		{
+			input: `[{"name": "a", "ops": 2, "carriers": [1, 3]}]`,
+			err:   `algorithm a: carrier op3 is out of range [1, 2]`,
+		},
+		{
+			input: `[{"name": "a", "ops": 2, "mods": [{"from": 2, "to": 2}], "carriers": [1]}]`,
+			err:   `algorithm a: op2 modulates itself, use feedback instead`,
+		},
+		{
+			input: `[{"name": "a", "ops": 2, "carriers": [1, 2], "feedback": {"from": 3, "to": 3}}]`,
+			err:   `algorithm a: feedback op3 -> op3 is out of range [1, 2]`,
+		},
+		{
+			input: `[{"name": "a", "ops": 4, "mods": [{"from": 2, "to": 1}, {"from": 3, "to": 2}, {"from": 4, "to": 3}, {"from": 2, "to": 4}], "carriers": [1]}]`,
+			err:   `algorithm a: modulation cycle op2 -> op4 -> op3 -> op2`,
+		},
+		{
+			input: `[{"name": "a", "ops": 3, "mods": [{"from": 2, "to": 1}, {"from": 2, "to": 3}], "carriers": [1]}]`,
+			err:   `algorithm a: op3 does not reach a carrier`,
+		},
+	} {
+		_, err := ReadAlgorithms(strings.NewReader(testcase.input))
+		if err == nil {
+			t.Fatalf("expected error for %s", testcase.input)
+		}
+		if expected, got := testcase.err, err.Error(); expected != got {
+			t.Fatalf("expected error %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestAddAlgorithm(t *testing.T) {
+	algo := Algorithm{Name: "test_add", NumOps: 2, Mods: []Mod{{2, 1}}, Carriers: []int{1}}
+	if err := addAlgorithm(algo); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		delete(synthdefs, algo.DefName())
+		delete(userAlgorithms, algo.Name)
+	}()
+
+	got, err := findAlgorithm("test_add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, got.NumOps; expected != got {
+		t.Fatalf("expected %d ops, got %d", expected, got)
+	}
+	if err := addAlgorithm(algo); err == nil {
+		t.Fatal("expected error when adding an algorithm twice")
+	}
+	if err := addAlgorithm(Algorithm{Name: "5", NumOps: 1, Carriers: []int{1}}); err == nil {
+		t.Fatal("expected error when redefining a DX7 algorithm")
+	}
+	if _, err := findAlgorithm("nope"); err == nil {
+		t.Fatal("expected error for missing algorithm")
+	}
+}
@@ -4,73 +4,145 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/scgolang/dx7/sysex"
 	"github.com/scgolang/midi"
-	"github.com/scgolang/sc"
 )
 
 const (
-	// polyphony is used to scale the gain of each synth voice.
-	polyphony = 4
-
-	// fmtAmtHi is the max value for op1amt.
-	fmtAmtHi = float32(2000)
-
 	// freqScaleLo is the min value for op2freqscale (as a power of 2).
 	freqScaleLo = float32(-8)
 
 	// freqScaleHi is the max value for op2freqscale (as a power of 2).
 	freqScaleHi = float32(2)
 
-	// decayLo is the min value for op2decay (in secs).
+	// decayLo is the min value for op2t2 (in secs).
 	decayLo = float32(0.0001)
 
-	// decayHi is the max value for op2decay (in secs).
+	// decayHi is the max value for op2t2 (in secs).
 	decayHi = float32(10)
+
+	// bendRange is the pitch bend range (in semitones).
+	bendRange = float32(2)
+
+	// bendCenter is the value of a MIDI pitch bend that does not bend.
+	bendCenter = 8192
 )
 
 var (
-	ops = []int{1, 2, 3, 4, 5, 6}
+	// fmAmtHi is the max value for op1amt.
+	fmAmtHi = float32(sysex.MaxModIndex)
+
+	// opDefaults are the values of the ctrls of an operator that
+	// are used when the synth's ctrls do not have one.
+	opDefaults = map[string]float32{
+		"gain":      defaultGain,
+		"amt":       defaultAmt,
+		"freqscale": 1,
+		"fixed":     0,
+		"phase":     0,
+		"ams":       0,
+	}
 )
 
+// voiceDefaults are the values of the ctrls that are shared by all
+// operators that are used when the synth's ctrls do not have one.
+var voiceDefaults = map[string]float32{
+	"feedback": 0,
+	"bend":     0,
+	"amp":      1.0 / defaultPolyphony,
+}
+
+// performanceCtrls are the ctrls that MIDI performance controllers
+// set. They are kept when a voice is loaded.
+var performanceCtrls = []string{"aftertouch", "bend", "modwheel"}
+
+func init() {
+	for param, val := range envDefaults {
+		opDefaults[param] = val
+	}
+	for param, val := range pitchEnvDefaults {
+		voiceDefaults[param] = val
+	}
+	for param, val := range lfoDefaults {
+		voiceDefaults[param] = val
+	}
+}
+
 func ctrlName(op int, name string) string {
 	return fmt.Sprintf("op%d%s", op, name)
 }
 
-// FromNote implements poly.Controller.
+// FromNote returns the ctrls of a synth node that plays a note.
 func (dx7 *DX7) FromNote(note midi.Note) map[string]float32 {
 	var (
-		ctrls = map[string]float32{"gate": float32(1)}
-		freq  = sc.Midicps(float32(note.Number))
-		gain  = float32(note.Velocity) / (127 * polyphony)
+		ctrls    = map[string]float32{"gate": float32(1)}
+		freq     = dx7.noteFreq(note.Number)
+		velocity = dx7.velocity(note.Velocity)
 	)
-	for op := range ops {
-		ctrls[ctrlName(op, "freq")] = freq
-		ctrls[ctrlName(op, "gain")] = gain
-		ctrls[ctrlName(op, "amt")] = dx7.ctrls["op1amt"]
-		ctrls[ctrlName(op, "freqscale")] = dx7.ctrls["op2freqscale"]
-		ctrls[ctrlName(op, "decay")] = dx7.ctrls["op2decay"]
-		ctrls[ctrlName(op, "sustain")] = dx7.ctrls["op2sustain"]
+	for param, def := range voiceDefaults {
+		if val, ok := dx7.ctrls[param]; ok {
+			ctrls[param] = val
+		} else {
+			ctrls[param] = def
+		}
+	}
+	ctrls["amp"] = 1 / float32(dx7.numVoices())
+
+	elapsed := dx7.elapsed()
+	if dx7.voice != nil {
+		ctrls["lfophase"] = phaseAt(dx7.voice.LFO.Sync, float64(ctrls["lfofreq"]), elapsed)
+	}
+	for op := 1; op <= dx7.numOps(); op++ {
+		for param, def := range opDefaults {
+			name := ctrlName(op, param)
+			if val, ok := dx7.ctrls[name]; ok {
+				ctrls[name] = val
+			} else {
+				ctrls[name] = def
+			}
+		}
+		dx7.keyScaling(ctrls, op, note.Number)
+		ctrls[ctrlName(op, "freq")] = float32(dx7.opFreq(op, freq))
+		ctrls[ctrlName(op, "phase")] = dx7.oscPhase(float64(ctrls[ctrlName(op, "freq")]), elapsed)
+		ctrls[ctrlName(op, "gain")] *= dx7.velocityGain(op, velocity)
 	}
 	return ctrls
 }
 
-// FromCtrl implements poly.Controller.
+// FromCtrl updates the ctrls for a MIDI control change.
+// It returns nil if the control change is not used.
 func (dx7 *DX7) FromCtrl(ctrl midi.CC) map[string]float32 {
 	switch ctrl.Number {
 	default:
 		return nil
+	case 1: // Mod Wheel
+		dx7.ctrls["modwheel"] = float32(ctrl.Value) / 127
 	case 106: // op1 FM Amt
-		dx7.ctrls["op1amt"] = float32(ctrl.Value) * (fmtAmtHi / 127)
+		dx7.ctrls["op1amt"] = float32(ctrl.Value) * (fmAmtHi / 127)
 	case 107: // op2 Freq Scale
 		dx7.ctrls["op2freqscale"] = getOp2FreqScale(ctrl.Value)
 	case 108:
-		dx7.ctrls["op2decay"] = linear(ctrl.Value, decayLo, decayHi)
+		dx7.ctrls["op2t2"] = linear(ctrl.Value, decayLo, decayHi)
 	case 109:
-		dx7.ctrls["op2sustain"] = float32(ctrl.Value) / 127
+		sustain := ampDB(float64(ctrl.Value) / 127)
+		dx7.ctrls["op2l2"] = sustain
+		dx7.ctrls["op2l3"] = sustain
 	}
 	return dx7.ctrls
 }
 
+// FromBend updates the ctrls for a MIDI pitch bend (0-16383).
+func (dx7 *DX7) FromBend(value int) map[string]float32 {
+	dx7.ctrls["bend"] = float32(value-bendCenter) / bendCenter * bendRange
+	return dx7.ctrls
+}
+
+// FromAftertouch updates the ctrls for a MIDI channel aftertouch (0-127).
+func (dx7 *DX7) FromAftertouch(value int) map[string]float32 {
+	dx7.ctrls["aftertouch"] = float32(value) / 127
+	return dx7.ctrls
+}
+
 // getOp2FreqScale returns a frequency scaling value for op2.
 func getOp2FreqScale(value int) float32 {
 	exp := float64(linear(value, freqScaleLo, freqScaleHi))
@@ -3,30 +3,82 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/scgolang/dx7/sysex"
 	"github.com/scgolang/sc"
 )
 
 // DX7 is a recreation of the legendary Yamaha DX7.
 type DX7 struct {
-	algorithm      int
+	algorithm      *Algorithm
+	algorithmName  string
+	algorithmsFile string
+	bank           *sysex.Bank
 	client         *sc.Client
 	ctrls          map[string]float32
 	flags          *flag.FlagSet
+	group          *sc.GroupNode
+	groupID        int
+	listDevices    bool
+	localAddr      string
 	midiDeviceName string
 	pass           bool
+	polyphony      int
 	scsynthAddr    string
+	start          time.Time
+	steal          string
+	syxFile        string
+	syxIndex       int
+	velocityCurve  string
+	voice          *sysex.BulkDump
+	voices         *voices
 }
 
-// Connect connects to scsynth.
-func (dx7 *DX7) Connect() error {
+// LoadAlgorithms loads user-defined algorithms from a JSON file.
+// See ReadAlgorithms for the format.
+func (dx7 *DX7) LoadAlgorithms(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening algorithms file")
+	}
+	defer func() { _ = f.Close() }()
+
+	algos, err := ReadAlgorithms(f)
+	if err != nil {
+		return err
+	}
+	for _, algo := range algos {
+		if err := addAlgorithm(algo); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Listen listens for MIDI events.
-func (dx7 *DX7) Listen() error {
-	return nil
+// elapsed returns the time since the DX7 played its first note.
+func (dx7 *DX7) elapsed() time.Duration {
+	if dx7.start.IsZero() {
+		dx7.start = time.Now()
+	}
+	return time.Since(dx7.start)
+}
+
+// numOps returns the number of operators of the current algorithm.
+func (dx7 *DX7) numOps() int {
+	if dx7.algorithm == nil {
+		return numOps
+	}
+	return dx7.algorithm.NumOps
+}
+
+// numVoices returns the number of notes that can play at once.
+func (dx7 *DX7) numVoices() int {
+	if dx7.polyphony < 1 {
+		return defaultPolyphony
+	}
+	return dx7.polyphony
 }
 
 // run runs the dx7.
@@ -34,6 +86,9 @@ func (dx7 *DX7) run() error {
 	if dx7.pass {
 		return nil
 	}
+	if dx7.listDevices {
+		return ListDevices(os.Stdout)
+	}
 	// Connect to scsynth.
 	if err := dx7.Connect(); err != nil {
 		return err
@@ -51,16 +106,26 @@ func (dx7 *DX7) run() error {
 // nodes will be added to the provided group.
 func New() (*DX7, error) {
 	dx7 := &DX7{
+		algorithm: &algorithms[0],
 		ctrls: map[string]float32{
 			"op1amt":       float32(defaultAmt),
 			"op2freqscale": float32(1),
-			"op2decay":     float32(defaultDecay),
-			"op2sustain":   float32(defaultSustain),
+			"op2t2":        float32(defaultDecay),
 		},
 		flags: flag.NewFlagSet("dx7", flag.ExitOnError),
 	}
-	dx7.flags.StringVar(&dx7.midiDeviceName, "d", "", "MIDI device name")
+	dx7.flags.StringVar(&dx7.algorithmName, "algorithm", "", "algorithm to play, overrides the algorithm of the voice")
+	dx7.flags.StringVar(&dx7.algorithmsFile, "algorithms", "", "JSON file with user-defined algorithms")
+	dx7.flags.StringVar(&dx7.midiDeviceName, "d", "", "MIDI device name or ID (default is the first MIDI input)")
+	dx7.flags.IntVar(&dx7.groupID, "group", defaultGroupID, "ID of the scsynth group that synth nodes are added to")
+	dx7.flags.BoolVar(&dx7.listDevices, "list-devices", false, "list MIDI devices and exit")
+	dx7.flags.StringVar(&dx7.localAddr, "local", "0.0.0.0:0", "local UDP address to receive replies from scsynth")
+	dx7.flags.IntVar(&dx7.polyphony, "polyphony", defaultPolyphony, "number of notes that can play at once")
 	dx7.flags.StringVar(&dx7.scsynthAddr, "scsynth", "127.0.0.1:57120", "scsynth UDP listening address")
+	dx7.flags.StringVar(&dx7.steal, "steal", stealOldest, "note to steal when all voices are playing (oldest or quietest)")
+	dx7.flags.StringVar(&dx7.syxFile, "syx", "", "sysex file to load a voice from")
+	dx7.flags.StringVar(&dx7.velocityCurve, "velocity-curve", defaultVelocityCurve, "velocity curve (linear, soft, hard or fixed)")
+	dx7.flags.IntVar(&dx7.syxIndex, "voice", 1, "voice to load from a sysex bank (1-32)")
 
 	if err := dx7.flags.Parse(os.Args[1:]); err != nil {
 		if err == flag.ErrHelp {
@@ -68,5 +133,34 @@ func New() (*DX7, error) {
 		}
 		return nil, errors.Wrap(err, "parsing flags")
 	}
+	if err := checkVelocityCurve(dx7.velocityCurve); err != nil {
+		return nil, err
+	}
+	if dx7.polyphony < 1 {
+		return nil, errors.Errorf("polyphony must be at least 1, got %d", dx7.polyphony)
+	}
+	if err := checkSteal(dx7.steal); err != nil {
+		return nil, err
+	}
+	if dx7.groupID <= int(sc.DefaultGroupID) {
+		return nil, errors.Errorf("group must be greater than %d, got %d", sc.DefaultGroupID, dx7.groupID)
+	}
+	if dx7.algorithmsFile != "" {
+		if err := dx7.LoadAlgorithms(dx7.algorithmsFile); err != nil {
+			return nil, errors.Wrap(err, "loading algorithms")
+		}
+	}
+	if dx7.algorithmName != "" {
+		algo, err := findAlgorithm(dx7.algorithmName)
+		if err != nil {
+			return nil, err
+		}
+		dx7.algorithm = algo
+	}
+	if dx7.syxFile != "" {
+		if err := dx7.LoadFile(dx7.syxFile, dx7.syxIndex-1); err != nil {
+			return nil, errors.Wrap(err, "loading voice")
+		}
+	}
 	return dx7, nil
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+
+	"github.com/scgolang/dx7/sysex"
+	"github.com/scgolang/sc"
+)
+
+// lfoDefaults are the default values of the LFO params.
+// lfofreq is the LFO frequency (in Hz), lfowave selects one of the
+// DX7's LFO waveforms (0=triangle, 1=saw down, 2=saw up, 3=square,
+// 4=sine, 5=sample and hold), and lfophase is the phase (0-1) the
+// LFO starts at. The LFO fades in lforamp seconds after lfoonset
+// seconds. pmd and amd are the pitch and amp mod depths (0-1), and
+// pms is the pitch deviation (in octaves) at full depth.
+// modwheel and aftertouch (0-1) add to both depths like the
+// DX7's mod wheel and aftertouch.
+var lfoDefaults = map[string]float32{
+	"lfofreq":    1,
+	"lfowave":    0,
+	"lfophase":   0,
+	"lfoonset":   0,
+	"lforamp":    0,
+	"pmd":        0,
+	"pms":        0,
+	"amd":        0,
+	"modwheel":   0,
+	"aftertouch": 0,
+}
+
+// LFO is the low frequency oscillator of a voice.
+type LFO struct {
+	// Pitch is the frequency ratio of the pitch modulation.
+	Pitch sc.Input
+
+	// Amp is the amp modulation in the range [0, 1].
+	// Each operator is attenuated by Amp times its amp mod
+	// sensitivity (in dB).
+	Amp sc.Input
+}
+
+// NewLFO adds the LFO params to a synthdef and creates the LFO.
+func NewLFO(p sc.Params) LFO {
+	var (
+		freq  = p.Add("lfofreq", lfoDefaults["lfofreq"])
+		wave  = p.Add("lfowave", lfoDefaults["lfowave"])
+		phase = p.Add("lfophase", lfoDefaults["lfophase"])
+		onset = p.Add("lfoonset", lfoDefaults["lfoonset"])
+		ramp  = p.Add("lforamp", lfoDefaults["lforamp"])
+		pmd   = p.Add("pmd", lfoDefaults["pmd"])
+		pms   = p.Add("pms", lfoDefaults["pms"])
+		amd   = p.Add("amd", lfoDefaults["amd"])
+		wheel = p.Add("modwheel", lfoDefaults["modwheel"])
+		touch = p.Add("aftertouch", lfoDefaults["aftertouch"])
+	)
+	// Every waveform is in the range [-1, 1].
+	waves := []sc.Input{
+		sc.LFTri{Freq: freq, Iphase: phase.Mul(sc.C(4))}.Rate(sc.KR),
+		sc.LFSaw{Freq: freq, Iphase: phase.Mul(sc.C(2))}.Rate(sc.KR).Neg(),
+		sc.LFSaw{Freq: freq, Iphase: phase.Mul(sc.C(2))}.Rate(sc.KR),
+		sc.LFPulse{Freq: freq, IPhase: phase}.Rate(sc.KR).MulAdd(sc.C(2), sc.C(-1)),
+		sc.SinOsc{Freq: freq, Phase: phase.Mul(sc.C(2 * math.Pi))}.Rate(sc.KR),
+		sc.LFNoise{Interpolation: sc.NoiseStep, Freq: freq}.Rate(sc.KR),
+	}
+	sig := sc.Select{Which: wave, Inputs: waves}.Rate(sc.KR)
+
+	// The LFO delay only applies to pmd and amd. Like on the DX7
+	// the mod wheel and aftertouch add to them immediately, up to
+	// full depth.
+	delay := sc.EnvGen{
+		Env: sc.Env{
+			Levels: []sc.Input{sc.C(0), sc.C(0), sc.C(1)},
+			Times:  []sc.Input{onset, ramp},
+		},
+	}.Rate(sc.KR)
+
+	var (
+		ctrl       = wheel.Add(touch)
+		pitchDepth = pmd.Mul(delay).Add(ctrl).Min(sc.C(1)).Mul(pms)
+		ampDepth   = amd.Mul(delay).Add(ctrl).Min(sc.C(1))
+	)
+	return LFO{
+		Pitch: sig.Mul(pitchDepth).Mul(sc.C(12)).Midiratio(),
+		Amp:   sig.MulAdd(sc.C(0.5), sc.C(0.5)).Mul(ampDepth),
+	}
+}
+
+// VoiceMod is the modulation that is shared by all the operators
+// of a voice.
+type VoiceMod struct {
+	// Pitch is the frequency ratio of the pitch envelope.
+	Pitch sc.Input
+
+	// Vibrato is the frequency ratio of the pitch modulation of the
+	// LFO and the pitch bend.
+	Vibrato sc.Input
+
+	// Amp is the amp modulation of the LFO.
+	Amp sc.Input
+}
+
+// voiceMod adds the pitch envelope, LFO and pitch bend params to a
+// synthdef and creates the modulation for its operators.
+// bend is the pitch bend in semitones.
+func voiceMod(p sc.Params, gate sc.Input) VoiceMod {
+	var (
+		pitch = pitchEnv(p, gate)
+		lfo   = NewLFO(p)
+		bend  = p.Add("bend", voiceDefaults["bend"])
+	)
+	return VoiceMod{
+		Pitch:   pitch,
+		Vibrato: lfo.Pitch.Mul(bend.Midiratio()),
+		Amp:     lfo.Amp,
+	}
+}
+
+// lfoCtrls returns the values of the LFO params for a DX7 LFO.
+func lfoCtrls(lfo sysex.LFO) map[string]float32 {
+	onset, ramp := lfo.DelayTimes()
+
+	return map[string]float32{
+		"lfofreq":  float32(lfo.Freq()),
+		"lfowave":  float32(lfo.Wave),
+		"lfoonset": float32(onset),
+		"lforamp":  float32(ramp),
+		"pmd":      float32(lfo.PitchModDepth()),
+		"pms":      float32(sysex.PitchModRange(lfo.PMSensitivity)),
+		"amd":      float32(lfo.AmpModDepth()),
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/scgolang/sc"
+)
+
+// lfoDef creates a synthdef that plays nothing but an LFO.
+func lfoDef() *sc.Synthdef {
+	return sc.NewSynthdef("dx7_lfo", func(p sc.Params) sc.Ugen {
+		lfo := NewLFO(p)
+		return sc.Out{Bus: sc.C(0), Channels: sc.Multi(lfo.Pitch, lfo.Amp)}.Rate(sc.KR)
+	})
+}
+
+// paramInput returns the input that reads a param of a synthdef.
+func paramInput(t *testing.T, def *sc.Synthdef, name string) sc.UgenInput {
+	for _, param := range def.ParamNames {
+		if param.Name == name {
+			return sc.UgenInput{UgenIndex: 0, OutputIndex: param.Index}
+		}
+	}
+	t.Fatalf("no param named %s", name)
+	return sc.UgenInput{}
+}
+
+// findUgens returns the inputs that read the ugens of a synthdef with a name.
+func findUgens(def *sc.Synthdef, name string) []sc.UgenInput {
+	var found []sc.UgenInput
+	for i, ugen := range def.Ugens {
+		if ugen.Name == name {
+			found = append(found, sc.UgenInput{UgenIndex: int32(i)})
+		}
+	}
+	return found
+}
+
+// findBinOp returns the input that reads a binary op of two inputs,
+// and false if the synthdef does not have one.
+func findBinOp(def *sc.Synthdef, op int16, a, b sc.UgenInput) (sc.UgenInput, bool) {
+	for _, in := range findUgens(def, sc.BinOpUgenName) {
+		ugen := def.Ugens[in.UgenIndex]
+		if ugen.SpecialIndex == op && ugen.Inputs[0] == a && ugen.Inputs[1] == b {
+			return in, true
+		}
+	}
+	return sc.UgenInput{}, false
+}
+
+// constInput returns the input that reads a constant of a synthdef.
+func constInput(t *testing.T, def *sc.Synthdef, c float32) sc.UgenInput {
+	for i, val := range def.Constants {
+		if val == c {
+			return sc.UgenInput{UgenIndex: -1, OutputIndex: int32(i)}
+		}
+	}
+	t.Fatalf("no constant %f", c)
+	return sc.UgenInput{}
+}
+
+func TestLFOWaves(t *testing.T) {
+	def := lfoDef()
+
+	selects := findUgens(def, "Select")
+	if expected, got := 1, len(selects); expected != got {
+		t.Fatalf("expected %d Select, got %d", expected, got)
+	}
+	sel := def.Ugens[selects[0].UgenIndex]
+	if expected, got := paramInput(t, def, "lfowave"), sel.Inputs[0]; expected != got {
+		t.Fatalf("expected lfowave to select the waveform, got %v", got)
+	}
+	var (
+		waves = sel.Inputs[1:]
+		names = []string{"LFTri", "LFSaw", "LFSaw", "LFPulse", "SinOsc", "LFNoise0"}
+	)
+	if expected, got := len(names), len(waves); expected != got {
+		t.Fatalf("expected %d waveforms, got %d", expected, got)
+	}
+	for i, name := range names {
+		if !dependsOn(def, waves[i], name) {
+			t.Fatalf("waveform %d: expected %s", i, name)
+		}
+	}
+	if waves[1] == waves[2] {
+		t.Fatal("expected saw down and saw up to be different waveforms")
+	}
+	// LFTri and LFSaw start at a phase in the range [0, 4) and [0, 2).
+	phase := paramInput(t, def, "lfophase")
+	for name, scale := range map[string]float32{"LFTri": 4, "LFSaw": 2} {
+		for _, in := range findUgens(def, name) {
+			var (
+				iphase = def.Ugens[def.Ugens[in.UgenIndex].Inputs[1].UgenIndex]
+				scaled = []sc.UgenInput{phase, constInput(t, def, scale)}
+			)
+			if iphase.Name != sc.BinOpUgenName || iphase.SpecialIndex != sc.BinOpMul || iphase.Inputs[0] != scaled[0] || iphase.Inputs[1] != scaled[1] {
+				t.Fatalf("%s: expected lfophase to be scaled by %f", name, scale)
+			}
+		}
+	}
+}
+
+func TestLFODelay(t *testing.T) {
+	def := lfoDef()
+
+	envs := findUgens(def, "EnvGen")
+	if expected, got := 1, len(envs); expected != got {
+		t.Fatalf("expected %d EnvGen, got %d", expected, got)
+	}
+	var (
+		delay = envs[0]
+		one   = constInput(t, def, 1)
+	)
+	ctrl, ok := findBinOp(def, sc.BinOpAdd, paramInput(t, def, "modwheel"), paramInput(t, def, "aftertouch"))
+	if !ok {
+		t.Fatal("expected the mod wheel and aftertouch to be added")
+	}
+	for _, param := range []string{"pmd", "amd"} {
+		// The delay gates the depth of the voice, but not
+		// the depth added by the mod wheel and aftertouch.
+		gated, ok := findBinOp(def, sc.BinOpMul, paramInput(t, def, param), delay)
+		if !ok {
+			t.Fatalf("expected the LFO delay to gate %s", param)
+		}
+		depth, ok := findBinOp(def, sc.BinOpAdd, gated, ctrl)
+		if !ok {
+			t.Fatalf("expected the mod wheel and aftertouch to add to %s", param)
+		}
+		if _, ok := findBinOp(def, sc.BinOpMin, depth, one); !ok {
+			t.Fatalf("expected the depth of %s to be clamped to 1", param)
+		}
+	}
+}
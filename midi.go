@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/dx7/midistream"
+	"github.com/scgolang/midi"
+)
+
+// midiQueueSize is the number of MIDI packets that are buffered.
+const midiQueueSize = 64
+
+// Listen plays the MIDI events of the device selected with -d
+// until the device can not be read anymore.
+// If no device was selected it uses the first MIDI input.
+func (dx7 *DX7) Listen() error {
+	devices, err := midi.Devices()
+	if err != nil {
+		return errors.Wrap(err, "listing MIDI devices")
+	}
+	device, err := findDevice(devices, dx7.midiDeviceName)
+	if err != nil {
+		return err
+	}
+	device.QueueSize = midiQueueSize
+
+	if err := device.Open(); err != nil {
+		return errors.Wrapf(err, "opening MIDI device %s", device.ID)
+	}
+	defer func() { _ = device.Close() }()
+
+	logger.Printf("listening to MIDI device %q (%s)\n", device.Name, device.ID)
+
+	var r io.Reader
+	if raw, ok := interface{}(device).(io.Reader); ok {
+		r = rawReader{r: raw}
+	} else {
+		// Devices that can not be read as a byte stream
+		// deliver MIDI messages in packets.
+		packets, err := device.Packets()
+		if err != nil {
+			return errors.Wrapf(err, "reading MIDI device %s", device.ID)
+		}
+		r = &packetReader{packets: packets}
+	}
+	events := midistream.NewReader(r)
+
+	for {
+		event, err := events.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "reading MIDI device %s", device.ID)
+		}
+		// A bad message should not stop the music.
+		if err := dx7.Handle(event.Bytes()); err != nil {
+			logger.Println(err)
+		}
+	}
+}
+
+// rawReader reads the byte stream of a MIDI device.
+// A device returns a negative count when a read fails, and it
+// may return a stale error, such as EAGAIN or EINTR, along with
+// a count of 0 or more. A read that returns nothing is retried.
+type rawReader struct {
+	r io.Reader
+}
+
+// Read implements io.Reader.
+func (r rawReader) Read(b []byte) (int, error) {
+	for {
+		n, err := r.r.Read(b)
+		if n > 0 {
+			return n, nil
+		}
+		if n == 0 && err == io.EOF {
+			return 0, io.EOF
+		}
+		if n == 0 {
+			continue
+		}
+		if err == nil {
+			err = errors.Errorf("read failed (%d)", n)
+		}
+		return 0, err
+	}
+}
+
+// packetReader reads the MIDI messages of a channel of packets
+// as a byte stream.
+type packetReader struct {
+	packets <-chan midi.Packet
+	pending []byte
+}
+
+// Read implements io.Reader.
+func (r *packetReader) Read(b []byte) (int, error) {
+	if len(r.pending) == 0 {
+		packet, ok := <-r.packets
+		if !ok {
+			return 0, io.EOF
+		}
+		if packet.Err != nil {
+			return 0, packet.Err
+		}
+		r.pending = packet.Data[:packetLength(packet.Data[0])]
+	}
+	n := copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// packetLength returns how many bytes of a packet that
+// starts with a specific byte are part of the MIDI stream.
+// Packets are padded, so the length of a message that is
+// shorter than a packet is given by its status.
+func packetLength(status byte) int {
+	if n := midistream.DataLength(status); status >= 0x80 && n >= 0 {
+		return n + 1
+	}
+	return len(midi.Packet{}.Data)
+}
+
+// ListDevices writes the ID, name and type of every MIDI device to w.
+func ListDevices(w io.Writer) error {
+	devices, err := midi.Devices()
+	if err != nil {
+		return errors.Wrap(err, "listing MIDI devices")
+	}
+	for _, device := range devices {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", device.ID, device.Name, deviceType(device.Type)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deviceType returns the name of a MIDI device type.
+func deviceType(t midi.DeviceType) string {
+	switch t {
+	case midi.DeviceInput:
+		return "input"
+	case midi.DeviceOutput:
+		return "output"
+	default:
+		return "duplex"
+	}
+}
+
+// findDevice finds a MIDI input device by name or ID.
+// If name is empty it returns the first input device.
+func findDevice(devices []*midi.Device, name string) (*midi.Device, error) {
+	var inputs []*midi.Device
+	for _, device := range devices {
+		if device.Type != midi.DeviceOutput {
+			inputs = append(inputs, device)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("no MIDI input devices found")
+	}
+	if name == "" {
+		return inputs[0], nil
+	}
+	names := make([]string, len(inputs))
+	for i, device := range inputs {
+		if device.Name == name || device.ID == name {
+			return device, nil
+		}
+		names[i] = fmt.Sprintf("%q (%s)", device.Name, device.ID)
+	}
+	return nil, errors.Errorf("no MIDI input device named %q, available devices are %s", name, strings.Join(names, ", "))
+}
+
+// Handle plays a MIDI channel message, or loads the voice or bank
+// of a DX7 bulk dump. Messages are received on all channels.
+func (dx7 *DX7) Handle(msg []byte) error {
+	if len(msg) == 0 {
+		return nil
+	}
+	if msg[0] == midistream.SysexStart {
+		return dx7.LoadSysex(msg)
+	}
+	var data [2]int
+	for i := range data {
+		if i+1 < len(msg) {
+			data[i] = int(msg[i+1])
+		}
+	}
+	switch msg[0] & 0xF0 {
+	case midistream.NoteOff:
+		return dx7.voices.NoteOff(data[0])
+	case midistream.NoteOn:
+		if data[1] == 0 {
+			return dx7.voices.NoteOff(data[0])
+		}
+		note := midi.Note{Number: data[0], Velocity: data[1]}
+		return dx7.voices.NoteOn(note.Number, note.Velocity, dx7.algorithm.DefName(), dx7.FromNote(note))
+	case midistream.CC:
+		return dx7.update(func() map[string]float32 {
+			return dx7.FromCtrl(midi.CC{Number: data[0], Value: data[1]})
+		})
+	case midistream.ProgramChange:
+		return dx7.ProgramChange(data[0])
+	case midistream.ChanAftertouch:
+		return dx7.update(func() map[string]float32 {
+			return dx7.FromAftertouch(data[0])
+		})
+	case midistream.PitchBend:
+		return dx7.update(func() map[string]float32 {
+			return dx7.FromBend(data[0] | data[1]<<7)
+		})
+	}
+	return nil
+}
+
+// update applies a change of the ctrls to the notes that are playing.
+// Only the ctrls that change are sent, so the ctrls that FromNote
+// computed for each note are kept.
+func (dx7 *DX7) update(f func() map[string]float32) error {
+	before := make(map[string]float32, len(dx7.ctrls))
+	for param, val := range dx7.ctrls {
+		before[param] = val
+	}
+	changed := map[string]float32{}
+	for param, val := range f() {
+		if old, ok := before[param]; !ok || old != val {
+			changed[param] = val
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return dx7.voices.Set(changed)
+}
+
+// ProgramChange loads a voice from the bank that was loaded with -syx
+// or received over MIDI.
+// Notes that are playing keep the voice they started with.
+func (dx7 *DX7) ProgramChange(program int) error {
+	if dx7.bank == nil {
+		return errors.Errorf("no bank loaded for program change %d", program)
+	}
+	if program >= len(dx7.bank) {
+		return errors.Errorf("no voice for program %d in the loaded bank (%d voices)", program, len(dx7.bank))
+	}
+	return dx7.LoadVoice(dx7.bank[program])
+}
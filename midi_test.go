@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/scgolang/dx7/midistream"
+	"github.com/scgolang/dx7/sysex"
+	"github.com/scgolang/midi"
+	"github.com/scgolang/sc"
+)
+
+// fakeServer records the synth nodes that the DX7 plays.
+type fakeServer struct {
+	nextID int32
+	defs   map[int32]string
+	ctrls  map[int32]map[string]float32
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		nextID: 1000,
+		defs:   map[int32]string{},
+		ctrls:  map[int32]map[string]float32{},
+	}
+}
+
+func (s *fakeServer) NextSynthID() int32 {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *fakeServer) NodeSet(id int32, ctls map[string]float32) error {
+	for param, val := range ctls {
+		s.ctrls[id][param] = val
+	}
+	return nil
+}
+
+func (s *fakeServer) Synth(defName string, id, action, target int32, ctls map[string]float32) (*sc.Synth, error) {
+	s.defs[id] = defName
+	s.ctrls[id] = map[string]float32{}
+	for param, val := range ctls {
+		s.ctrls[id][param] = val
+	}
+	return &sc.Synth{DefName: defName, ID: id}, nil
+}
+
+func newTestDX7(t *testing.T) (*DX7, *fakeServer) {
+	dx7 := &DX7{}
+
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 3); err != nil {
+		t.Fatal(err)
+	}
+	server := newFakeServer()
+	dx7.voices = newVoices(server, defaultGroupID, defaultPolyphony, stealOldest)
+	return dx7, server
+}
+
+func TestHandle(t *testing.T) {
+	dx7, server := newTestDX7(t)
+
+	if err := dx7.Handle([]byte{0x90, 60, 100}); err != nil {
+		t.Fatal(err)
+	}
+	id := server.nextID
+	if expected, got := "dx7_algo2", server.defs[id]; expected != got {
+		t.Fatalf("expected synthdef %s, got %s", expected, got)
+	}
+	gain := server.ctrls[id][ctrlName(1, "gain")]
+
+	// Pitch bend all the way up.
+	if err := dx7.Handle([]byte{0xE3, 0x7F, 0x7F}); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.ctrls[id]["bend"]; got < 1.99 || got > 2 {
+		t.Fatalf("expected bend of about 2 semitones, got %f", got)
+	}
+	if err := dx7.Handle([]byte{0xB0, 1, 127}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := float32(1), server.ctrls[id]["modwheel"]; expected != got {
+		t.Fatalf("expected mod wheel %f, got %f", expected, got)
+	}
+	if err := dx7.Handle([]byte{0xD0, 127}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := float32(1), server.ctrls[id]["aftertouch"]; expected != got {
+		t.Fatalf("expected aftertouch %f, got %f", expected, got)
+	}
+	if expected, got := gain, server.ctrls[id][ctrlName(1, "gain")]; expected != got {
+		t.Fatalf("expected controllers to keep gain %f, got %f", expected, got)
+	}
+	// Note on with velocity 0 releases the note.
+	if err := dx7.Handle([]byte{0x90, 60, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := float32(0), server.ctrls[id]["gate"]; expected != got {
+		t.Fatalf("expected gate %f, got %f", expected, got)
+	}
+	if !dx7.voices.nodes[0].released {
+		t.Fatal("expected note to be released")
+	}
+}
+
+func TestProgramChange(t *testing.T) {
+	dx7, server := newTestDX7(t)
+
+	// BRASS 1 uses algorithm 22.
+	if err := dx7.Handle([]byte{0xC0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "BRASS   1 ", dx7.voice.Name; expected != got {
+		t.Fatalf("expected voice %q, got %q", expected, got)
+	}
+	if err := dx7.Handle([]byte{0x90, 60, 100}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "dx7_algo22", server.defs[server.nextID]; expected != got {
+		t.Fatalf("expected synthdef %s, got %s", expected, got)
+	}
+	if err := dx7.Handle([]byte{0xC0, 32}); err == nil {
+		t.Fatal("expected error for program out of range")
+	}
+}
+
+func TestFindDevice(t *testing.T) {
+	devices := []*midi.Device{
+		{ID: "hw:0,0,0", Name: "Synth Out", Type: midi.DeviceOutput},
+		{ID: "hw:1,0,0", Name: "Keys", Type: midi.DeviceInput},
+		{ID: "hw:2,0,0", Name: "Pads", Type: midi.DeviceDuplex},
+	}
+	for _, testcase := range []struct {
+		name string
+		id   string
+	}{
+		{"", "hw:1,0,0"},
+		{"Pads", "hw:2,0,0"},
+		{"hw:1,0,0", "hw:1,0,0"},
+	} {
+		device, err := findDevice(devices, testcase.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := testcase.id, device.ID; expected != got {
+			t.Fatalf("%q: expected device %s, got %s", testcase.name, expected, got)
+		}
+	}
+	if _, err := findDevice(devices, "Synth Out"); err == nil {
+		t.Fatal("expected error for output device")
+	}
+	if _, err := findDevice(nil, ""); err == nil {
+		t.Fatal("expected error without devices")
+	}
+}
+
+func TestPacketReader(t *testing.T) {
+	packets := make(chan midi.Packet, 3)
+	packets <- midi.Packet{Data: [3]byte{0xC0, 5, 0}}
+	packets <- midi.Packet{Data: [3]byte{0x90, 60, 100}}
+	packets <- midi.Packet{Data: [3]byte{0xF8, 0, 0}}
+	close(packets)
+
+	data, err := ioutil.ReadAll(&packetReader{packets: packets})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := []byte{0xC0, 5, 0x90, 60, 100, 0xF8}, data; !bytes.Equal(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestRawReader(t *testing.T) {
+	if _, err := (rawReader{r: badReader{}}).Read(make([]byte, 3)); err == nil {
+		t.Fatal("expected error for negative count")
+	}
+}
+
+// badReader is a reader that fails like a MIDI device.
+type badReader struct{}
+
+func (badReader) Read(b []byte) (int, error) {
+	return -1, nil
+}
+
+func TestRawReaderStaleError(t *testing.T) {
+	r := &staleReader{
+		errs: []error{syscall.EAGAIN, syscall.EINTR},
+		data: []byte{0x90, 60, 100},
+	}
+	data, err := ioutil.ReadAll(rawReader{r: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := []byte{0x90, 60, 100}, data; !bytes.Equal(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if expected, got := 0, len(r.errs); expected != got {
+		t.Fatalf("expected every stale error to be read, %d left", got)
+	}
+}
+
+// staleReader is a reader that returns nothing along with a stale
+// error a few times before it returns its data, like a MIDI device
+// whose read was interrupted.
+type staleReader struct {
+	errs []error
+	data []byte
+}
+
+func (r *staleReader) Read(b []byte) (int, error) {
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return 0, err
+	}
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, syscall.EAGAIN
+}
+
+func TestReceiveBulkDump(t *testing.T) {
+	dx7, _ := newTestDX7(t)
+
+	f, err := os.Open("assets/syx/rom1a.syx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	bank, err := sysex.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voice, err := (&sysex.Sysex{FormatNumber: sysex.FormatSingleVoice, Voice: bank.Data[0]}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bankDump, err := bank.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A clock byte in the middle of the dump must not break it.
+	stream := append(append([]byte{}, voice[:50]...), 0xF8)
+	stream = append(stream, voice[50:]...)
+
+	var p midistream.Parser
+	for _, event := range p.Parse(stream) {
+		if err := dx7.Handle(event.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected, got := "BRASS   1 ", dx7.voice.Name; expected != got {
+		t.Fatalf("expected voice %q, got %q", expected, got)
+	}
+	// A bank dump replaces the bank, but not the current voice.
+	dx7.bank = nil
+
+	if err := dx7.Handle(bankDump); err != nil {
+		t.Fatal(err)
+	}
+	if dx7.bank == nil {
+		t.Fatal("expected bank to be loaded")
+	}
+	if expected, got := "BRASS   1 ", dx7.voice.Name; expected != got {
+		t.Fatalf("expected voice %q, got %q", expected, got)
+	}
+	// A voice that was corrupted in transit has a bad checksum.
+	// It is rejected, and the current voice stays loaded.
+	voice[6+145] = 'X'
+
+	if err := dx7.Handle(voice); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	if expected, got := "BRASS   1 ", dx7.voice.Name; expected != got {
+		t.Fatalf("expected voice %q to stay loaded, got %q", expected, got)
+	}
+	// Other sysex messages are ignored.
+	if err := dx7.Handle([]byte{0xF0, 0x41, 0x10, 0xF7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dx7.Handle([]byte{0xF0, 0x43, 0x10, 0x01, 0x02, 0x03, 0xF7}); err != nil {
+		t.Fatal(err)
+	}
+}
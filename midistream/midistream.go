@@ -0,0 +1,249 @@
+// Package midistream parses raw MIDI byte streams.
+// It handles running status, realtime messages that are interleaved
+// with other messages, and system exclusive messages of any length,
+// so it can read MIDI from devices, files and sockets alike.
+package midistream
+
+import (
+	"io"
+)
+
+// Message types, which are the status bytes of channel
+// messages without their channel.
+const (
+	NoteOff        = 0x80
+	NoteOn         = 0x90
+	PolyAftertouch = 0xA0
+	CC             = 0xB0
+	ProgramChange  = 0xC0
+	ChanAftertouch = 0xD0
+	PitchBend      = 0xE0
+	SysexStart     = 0xF0
+	TimeCode       = 0xF1
+	SongPosition   = 0xF2
+	SongSelect     = 0xF3
+	TuneRequest    = 0xF6
+	SysexEnd       = 0xF7
+)
+
+// DefaultMaxSysex is the default maximum length of a sysex message.
+// It is much longer than a DX7 bank dump.
+const DefaultMaxSysex = 1 << 16
+
+const (
+	statusBit      = 0x80
+	channelMask    = 0x0F
+	typeMask       = 0xF0
+	systemStatus   = 0xF0
+	realtimeStatus = 0xF8
+	readBufferSize = 256
+)
+
+// Event is a MIDI message.
+type Event struct {
+	// Status is the status byte of the message.
+	// The status of a channel message includes its channel.
+	Status byte
+
+	// Data are the data bytes of the message.
+	// For a sysex message they are the bytes between SysexStart and SysexEnd.
+	Data []byte
+}
+
+// Type returns the type of a channel message without its
+// channel, and the status of any other message.
+func (e Event) Type() byte {
+	if e.Status < systemStatus {
+		return e.Status & typeMask
+	}
+	return e.Status
+}
+
+// Channel returns the channel (0-15) of a channel message.
+func (e Event) Channel() int {
+	return int(e.Status & channelMask)
+}
+
+// Realtime reports whether the event is a realtime message,
+// such as timing clock or active sensing.
+func (e Event) Realtime() bool {
+	return e.Status >= realtimeStatus
+}
+
+// Bytes returns the message as it is sent over MIDI.
+// A sysex message includes SysexStart and SysexEnd.
+func (e Event) Bytes() []byte {
+	b := append([]byte{e.Status}, e.Data...)
+	if e.Status == SysexStart {
+		b = append(b, SysexEnd)
+	}
+	return b
+}
+
+// DataLength returns the number of data bytes of a message
+// with a specific status, or -1 for sysex messages which can
+// have any length.
+func DataLength(status byte) int {
+	switch status & typeMask {
+	case NoteOff, NoteOn, PolyAftertouch, CC, PitchBend:
+		return 2
+	case ProgramChange, ChanAftertouch:
+		return 1
+	}
+	switch status {
+	case SysexStart:
+		return -1
+	case TimeCode, SongSelect:
+		return 1
+	case SongPosition:
+		return 2
+	}
+	return 0
+}
+
+// Parser parses a MIDI byte stream into events.
+// Data bytes without a status are dropped, and so are sysex
+// messages that are interrupted by another status or that are
+// longer than MaxSysex.
+// The zero value is a parser that is ready to use.
+type Parser struct {
+	// MaxSysex is the maximum number of data bytes of a sysex
+	// message. If it is 0 DefaultMaxSysex is used.
+	MaxSysex int
+
+	status   byte
+	data     []byte
+	inSysex  bool
+	overflow bool
+}
+
+// Parse parses bytes of a MIDI stream, and returns the events
+// that they complete. Messages may span several calls to Parse.
+func (p *Parser) Parse(b []byte) []Event {
+	var events []Event
+	for _, c := range b {
+		if e, ok := p.parse(c); ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// parse parses one byte of a MIDI stream.
+func (p *Parser) parse(c byte) (Event, bool) {
+	switch {
+	case c >= realtimeStatus:
+		// Realtime messages can appear anywhere, even in the middle
+		// of another message, and they do not change the running status.
+		return Event{Status: c}, true
+
+	case c == SysexEnd:
+		return p.endSysex()
+
+	case c&statusBit != 0:
+		p.status = c
+		p.data = p.data[:0]
+		p.inSysex = c == SysexStart
+		p.overflow = false
+
+		if DataLength(c) == 0 {
+			return p.emit()
+		}
+		return Event{}, false
+
+	case p.inSysex:
+		if len(p.data) >= p.maxSysex() {
+			p.overflow = true
+			return Event{}, false
+		}
+		p.data = append(p.data, c)
+		return Event{}, false
+
+	case p.status == 0:
+		return Event{}, false
+	}
+	p.data = append(p.data, c)
+
+	if len(p.data) < DataLength(p.status) {
+		return Event{}, false
+	}
+	return p.emit()
+}
+
+// emit returns the event that was parsed.
+// Channel messages keep their status as the running status,
+// which is cleared by all other messages.
+func (p *Parser) emit() (Event, bool) {
+	e := Event{
+		Status: p.status,
+		Data:   append([]byte(nil), p.data...),
+	}
+	p.data = p.data[:0]
+
+	if p.status >= systemStatus {
+		p.status = 0
+	}
+	return e, true
+}
+
+// endSysex returns the sysex message that SysexEnd completes.
+func (p *Parser) endSysex() (Event, bool) {
+	if !p.inSysex || p.overflow {
+		p.reset()
+		return Event{}, false
+	}
+	p.inSysex = false
+	return p.emit()
+}
+
+// reset drops the message that is being parsed.
+func (p *Parser) reset() {
+	p.status = 0
+	p.data = p.data[:0]
+	p.inSysex = false
+	p.overflow = false
+}
+
+// maxSysex returns the maximum length of a sysex message.
+func (p *Parser) maxSysex() int {
+	if p.MaxSysex > 0 {
+		return p.MaxSysex
+	}
+	return DefaultMaxSysex
+}
+
+// Reader reads events from a MIDI byte stream.
+type Reader struct {
+	Parser
+
+	r      io.Reader
+	buf    []byte
+	events []Event
+	err    error
+}
+
+// NewReader creates a reader that reads events from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r:   r,
+		buf: make([]byte, readBufferSize),
+	}
+}
+
+// Read returns the next event of the stream.
+// It returns the error of the underlying reader once all the
+// events that were read before the error have been returned,
+// which is io.EOF at the end of the stream.
+func (r *Reader) Read() (Event, error) {
+	for len(r.events) == 0 {
+		if r.err != nil {
+			return Event{}, r.err
+		}
+		var n int
+		n, r.err = r.r.Read(r.buf)
+		r.events = r.Parse(r.buf[:n])
+	}
+	e := r.events[0]
+	r.events = r.events[1:]
+	return e, nil
+}
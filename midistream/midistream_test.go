@@ -0,0 +1,165 @@
+package midistream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Input  []byte
+		Events []Event
+	}{
+		{
+			Name:  "note on and off",
+			Input: []byte{0x90, 60, 100, 0x80, 60, 0},
+			Events: []Event{
+				{Status: 0x90, Data: []byte{60, 100}},
+				{Status: 0x80, Data: []byte{60, 0}},
+			},
+		},
+		{
+			Name:  "running status",
+			Input: []byte{0x91, 60, 100, 64, 100, 60, 0},
+			Events: []Event{
+				{Status: 0x91, Data: []byte{60, 100}},
+				{Status: 0x91, Data: []byte{64, 100}},
+				{Status: 0x91, Data: []byte{60, 0}},
+			},
+		},
+		{
+			Name:  "two byte messages",
+			Input: []byte{0xC0, 5, 6, 0xD2, 127},
+			Events: []Event{
+				{Status: 0xC0, Data: []byte{5}},
+				{Status: 0xC0, Data: []byte{6}},
+				{Status: 0xD2, Data: []byte{127}},
+			},
+		},
+		{
+			Name:  "realtime in the middle of a message",
+			Input: []byte{0xB0, 0xF8, 1, 0xFE, 64, 2, 0xF8, 3},
+			Events: []Event{
+				{Status: 0xF8},
+				{Status: 0xFE},
+				{Status: 0xB0, Data: []byte{1, 64}},
+				{Status: 0xF8},
+				{Status: 0xB0, Data: []byte{2, 3}},
+			},
+		},
+		{
+			Name:  "sysex",
+			Input: []byte{0xF0, 0x43, 0x00, 0xF8, 0x09, 0xF7, 0x90, 60, 1},
+			Events: []Event{
+				{Status: 0xF8},
+				{Status: 0xF0, Data: []byte{0x43, 0x00, 0x09}},
+				{Status: 0x90, Data: []byte{60, 1}},
+			},
+		},
+		{
+			Name:  "sysex clears running status",
+			Input: []byte{0x90, 60, 1, 0xF0, 0x43, 0xF7, 62, 1},
+			Events: []Event{
+				{Status: 0x90, Data: []byte{60, 1}},
+				{Status: 0xF0, Data: []byte{0x43}},
+			},
+		},
+		{
+			Name:  "interrupted sysex",
+			Input: []byte{0xF0, 0x43, 0x00, 0x90, 60, 1, 0xF7},
+			Events: []Event{
+				{Status: 0x90, Data: []byte{60, 1}},
+			},
+		},
+		{
+			Name:  "system common",
+			Input: []byte{0xF2, 1, 2, 0xF6, 0xF3, 4},
+			Events: []Event{
+				{Status: 0xF2, Data: []byte{1, 2}},
+				{Status: 0xF6, Data: []byte{}},
+				{Status: 0xF3, Data: []byte{4}},
+			},
+		},
+		{
+			Name:  "data without status",
+			Input: []byte{60, 100, 0x90, 60, 100},
+			Events: []Event{
+				{Status: 0x90, Data: []byte{60, 100}},
+			},
+		},
+	} {
+		var p Parser
+		if expected, got := tc.Events, p.Parse(tc.Input); !equal(expected, got) {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, expected, got)
+		}
+	}
+}
+
+func TestParseMaxSysex(t *testing.T) {
+	p := Parser{MaxSysex: 2}
+
+	if events := p.Parse([]byte{0xF0, 1, 2, 3, 0xF7}); len(events) != 0 {
+		t.Fatalf("expected long sysex to be dropped, got %v", events)
+	}
+	if expected, got := []Event{{Status: 0xF0, Data: []byte{1, 2}}}, p.Parse([]byte{0xF0, 1, 2, 0xF7}); !equal(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestReader(t *testing.T) {
+	var (
+		sysex = append([]byte{0xF0}, bytes.Repeat([]byte{0x7F}, 4096)...)
+		input = append(append(sysex, 0xF7), 0xE0, 0, 64)
+		r     = NewReader(iotest.OneByteReader(bytes.NewReader(input)))
+	)
+	e, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := input[:len(sysex)+1], e.Bytes(); !bytes.Equal(expected, got) {
+		t.Fatalf("expected sysex of %d bytes, got %d bytes", len(expected), len(got))
+	}
+	e, err = r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := byte(PitchBend), e.Type(); expected != got {
+		t.Fatalf("expected type %x, got %x", expected, got)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestEvent(t *testing.T) {
+	e := Event{Status: 0x9A, Data: []byte{60, 100}}
+
+	if expected, got := byte(NoteOn), e.Type(); expected != got {
+		t.Fatalf("expected type %x, got %x", expected, got)
+	}
+	if expected, got := 10, e.Channel(); expected != got {
+		t.Fatalf("expected channel %d, got %d", expected, got)
+	}
+	if e.Realtime() || !(Event{Status: 0xFA}).Realtime() {
+		t.Fatal("expected only 0xFA to be realtime")
+	}
+	if expected, got := []byte{0x9A, 60, 100}, e.Bytes(); !bytes.Equal(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+// equal compares events, treating nil and empty data as equal.
+func equal(a, b []Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Status != b[i].Status || !bytes.Equal(a[i].Data, b[i].Data) {
+			return false
+		}
+	}
+	return true
+}
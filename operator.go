@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"strconv"
 
 	"github.com/scgolang/sc"
@@ -14,8 +15,42 @@ const (
 	defaultDecay   = 0.3
 	defaultSustain = 0.5
 	defaultRelease = 0.1
+
+	// silence is the level (in dB) of a silent envelope.
+	silence = -90
+
+	// numEGSegments is the number of segments of the amp envelope.
+	numEGSegments = 4
 )
 
+// envDefaults are the default values of the amp envelope params.
+// l0 is the level the envelope starts at, l1-l4 are the levels
+// at the end of each segment, t1-t4 the durations of the
+// segments and c1-c4 their curvatures.
+var envDefaults = map[string]float32{
+	"l0": silence,
+	"l1": 0,
+	"l2": ampDB(defaultSustain),
+	"l3": ampDB(defaultSustain),
+	"l4": silence,
+	"t1": defaultAttack,
+	"t2": defaultDecay,
+	"t3": 0,
+	"t4": defaultRelease,
+	"c1": 0,
+	"c2": 0,
+	"c3": 0,
+	"c4": 0,
+}
+
+// ampDB converts a linear gain to dB.
+func ampDB(gain float64) float32 {
+	if gain <= 0 {
+		return silence
+	}
+	return float32(math.Max(silence, 20*math.Log10(gain)))
+}
+
 // Operator is a sine wave signal combined with an envelope generator.
 type Operator struct {
 	// Freq is the oscillator frequency.
@@ -24,31 +59,74 @@ type Operator struct {
 	// FreqScale is a frequency scaling parameter.
 	FreqScale sc.Input
 
-	// FM is the frequency modulation input.
+	// Fixed is 1 if the oscillator plays a fixed frequency, and 0
+	// if it tracks the keyboard. Freq is set per note either way.
+	Fixed sc.Input
+
+	// Pitch is a frequency ratio that is shared by all the
+	// operators of a voice, such as the output of a pitch envelope.
+	Pitch sc.Input
+
+	// Vibrato is a frequency ratio like Pitch, such as the pitch
+	// modulation of an LFO. Like on the DX7 it does not change
+	// the frequency of fixed frequency oscillators.
+	Vibrato sc.Input
+
+	// Phase is the phase (in cycles, 0-1) the oscillator starts at.
+	Phase sc.Input
+
+	// FM is the modulation input.
+	// Like on the DX7 it modulates the phase of the oscillator.
 	FM sc.Input
 
-	// Amt controls the frequency modulation amount.
+	// Amt controls the modulation amount.
+	// It is the modulation index (in radians) of a modulator at full gain.
 	Amt sc.Input
 
+	// Feedback is the amount (in radians) of feedback that
+	// modulates the phase of the oscillator.
+	Feedback sc.Input
+
+	// FeedbackIn is the signal that is fed back, such as the output
+	// of a LocalIn that reads the output of this or another operator.
+	// Feedback has no effect if it is nil.
+	// A LocalIn reads what was written to its LocalOut during the
+	// previous control block, so unlike on the DX7 the fed back
+	// signal is a whole block late rather than one sample.
+	FeedbackIn sc.Input
+
 	// Gain is the output gain.
 	Gain sc.Input
 
-	// A is amp envelope attack (in seconds)
-	A sc.Input
+	// AmpMod is the amp modulation in the range [0, 1], such as
+	// the amp output of an LFO.
+	AmpMod sc.Input
+
+	// AmpModSens is the attenuation (in dB) of the operator
+	// when AmpMod is 1.
+	AmpModSens sc.Input
 
-	// D is amp envelope decay (in seconds)
-	D sc.Input
+	// Levels are the levels (in dB) of the amp envelope, which works
+	// like the 4-rate/4-level EG of the DX7: when a key is pressed
+	// it moves from Levels[0] to L1, L2 and L3, holds L3 until the
+	// key is released, and then moves to L4.
+	Levels [numEGSegments + 1]sc.Input
 
-	// S is amp envelope sustain [0, 1]
-	S sc.Input
+	// Times are the durations (in seconds) of the envelope segments.
+	Times [numEGSegments]sc.Input
 
-	// R is amp envelope release (in seconds)
-	R sc.Input
+	// Curves are the curvatures of the envelope segments.
+	// 0 is linear in dB, and negative values make a segment
+	// start fast and slow down.
+	Curves [numEGSegments]sc.Input
 
 	// Gate trigger the envelope and holds it open while > 0
 	Gate sc.Input
 
-	// Done is the ugen done action
+	// Done is the done action of the envelope.
+	// Every operator of a voice has its own release time, so the
+	// synth is freed when all of their envelopes are done
+	// (see freeWhenDone) rather than by a done action.
 	Done int
 }
 
@@ -69,17 +147,18 @@ func (op *Operator) defaults() {
 	if op.FM == nil {
 		op.FM = sc.C(0)
 	}
-	if op.A == nil {
-		op.A = sc.C(defaultAttack)
-	}
-	if op.D == nil {
-		op.D = sc.C(defaultDecay)
-	}
-	if op.S == nil {
-		op.S = sc.C(defaultSustain)
+	for i, level := range op.Levels {
+		if level == nil {
+			op.Levels[i] = sc.C(envDefaults["l"+strconv.Itoa(i)])
+		}
 	}
-	if op.R == nil {
-		op.R = sc.C(defaultRelease)
+	for i := range op.Times {
+		if op.Times[i] == nil {
+			op.Times[i] = sc.C(envDefaults["t"+strconv.Itoa(i+1)])
+		}
+		if op.Curves[i] == nil {
+			op.Curves[i] = sc.C(envDefaults["c"+strconv.Itoa(i+1)])
+		}
 	}
 	if op.Gate == nil {
 		op.Gate = sc.C(1)
@@ -89,42 +168,103 @@ func (op *Operator) defaults() {
 // Rate creates a new ugen at a specific rate.
 // If rate is an unsupported value this method will cause a runtime panic.
 func (op Operator) Rate(rate int8) sc.Input {
+	out, _ := op.ugens(rate)
+	return out
+}
+
+// ugens creates the ugens of the operator like Rate does, and
+// also returns its envelope generator.
+func (op Operator) ugens(rate int8) (out, eg sc.Input) {
 	// Check the rate and set defaults.
 	sc.CheckRate(rate)
 	(&op).defaults()
 
 	// Amp Envelope
-	adsr := sc.EnvADSR{A: op.A, D: op.D, S: op.S, R: op.R}
-	env := sc.EnvGen{
-		Env:        adsr,
-		Gate:       op.Gate,
-		LevelScale: op.Gain,
-		Done:       op.Done,
+	// The envelope runs in dB, so segments that are linear in dB
+	// decay exponentially like the ones of the DX7.
+	eg = sc.EnvGen{
+		Env: sc.Env{
+			Levels:      op.Levels[:],
+			Times:       op.Times[:],
+			Curve:       op.Curves[:],
+			ReleaseNode: sc.C(numEGSegments - 1),
+		},
+		Gate: op.Gate,
+		Done: op.Done,
 	}.Rate(sc.AR)
+	env := eg.DbAmp().Mul(op.Gain)
+
+	if op.AmpMod != nil && op.AmpModSens != nil {
+		env = env.Mul(op.AmpMod.Mul(op.AmpModSens).Neg().DbAmp())
+	}
 
-	// Modulate carrier frequency with FM input.
-	freq := op.Freq.MulAdd(op.FreqScale, op.FM.Mul(op.Amt))
+	freq := op.Freq.Mul(op.FreqScale)
+	if op.Pitch != nil {
+		freq = freq.Mul(op.Pitch)
+	}
+	if op.Vibrato != nil {
+		vibrato := op.Vibrato
+		if op.Fixed != nil {
+			vibrato = sc.Select{
+				Which:  op.Fixed,
+				Inputs: []sc.Input{vibrato, sc.C(1)},
+			}.Rate(sc.KR)
+		}
+		freq = freq.Mul(vibrato)
+	}
 
+	// Modulate carrier phase with FM input.
+	phase := op.FM.Mul(op.Amt)
+	if op.Phase != nil {
+		phase = phase.Add(op.Phase.Mul(sc.C(2 * math.Pi)))
+	}
+	if op.Feedback != nil && op.FeedbackIn != nil {
+		// A binary op runs at the rate of its receiver, so the
+		// sum is built from the audio rate feedback to keep it
+		// from being sampled once per control block.
+		phase = op.FeedbackIn.Mul(op.Feedback).Add(phase)
+	}
 	// Return the carrier.
-	return sc.SinOsc{Freq: freq}.Rate(sc.AR).Mul(env)
+	return sc.SinOsc{Freq: freq, Phase: phase}.Rate(sc.AR).Mul(env), eg
 }
 
 // NewOperator creates an operator with a specific index
 // and adds synth params to a synthdef.
-func NewOperator(i int, p sc.Params, gate, fm sc.Input) sc.Input {
+// It returns the output of the operator and its envelope generator.
+func NewOperator(i int, p sc.Params, gate sc.Input, mod VoiceMod, fm sc.Input) (out, eg sc.Input) {
+	return newOperator(i, p, gate, mod, fm).ugens(sc.AR)
+}
+
+// newOperator creates an operator like NewOperator does, but
+// without creating its ugen.
+func newOperator(i int, p sc.Params, gate sc.Input, mod VoiceMod, fm sc.Input) Operator {
 	name := "op" + strconv.Itoa(i)
 
-	return Operator{
-		Gate:      gate,
-		Freq:      p.Add(name+"freq", defaultFreq),
-		FreqScale: p.Add(name+"freqscale", 1),
-		Gain:      p.Add(name+"gain", defaultGain),
-		FM:        fm,
-		Amt:       p.Add(name+"amt", defaultAmt),
-		A:         p.Add(name+"attack", defaultAttack),
-		D:         p.Add(name+"decay", defaultDecay),
-		S:         p.Add(name+"sustain", defaultSustain),
-		R:         p.Add(name+"release", defaultRelease),
-		Done:      sc.FreeEnclosing,
-	}.Rate(sc.AR)
+	op := Operator{
+		Gate:       gate,
+		Freq:       p.Add(name+"freq", defaultFreq),
+		FreqScale:  p.Add(name+"freqscale", 1),
+		Fixed:      p.Add(name+"fixed", 0),
+		Pitch:      mod.Pitch,
+		Vibrato:    mod.Vibrato,
+		Phase:      p.Add(name+"phase", 0),
+		Gain:       p.Add(name+"gain", defaultGain),
+		AmpMod:     mod.Amp,
+		AmpModSens: p.Add(name+"ams", 0),
+		FM:         fm,
+		Amt:        p.Add(name+"amt", defaultAmt),
+	}
+	for i := range op.Levels {
+		param := "l" + strconv.Itoa(i)
+		op.Levels[i] = p.Add(name+param, envDefaults[param])
+	}
+	for i := range op.Times {
+		param := "t" + strconv.Itoa(i+1)
+		op.Times[i] = p.Add(name+param, envDefaults[param])
+	}
+	for i := range op.Curves {
+		param := "c" + strconv.Itoa(i+1)
+		op.Curves[i] = p.Add(name+param, envDefaults[param])
+	}
+	return op
 }
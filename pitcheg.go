@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/scgolang/dx7/sysex"
+	"github.com/scgolang/sc"
+)
+
+// pitchEnvDefaults are the default values of the pitch envelope params.
+// pl0 is the level the envelope starts at, pl1-pl4 are the levels
+// at the end of each segment (in semitones), and pt1-pt4 are the
+// durations of the segments.
+// By default the pitch envelope does not change the pitch.
+var pitchEnvDefaults = map[string]float32{
+	"pl0": 0,
+	"pl1": 0,
+	"pl2": 0,
+	"pl3": 0,
+	"pl4": 0,
+	"pt1": 0,
+	"pt2": 0,
+	"pt3": 0,
+	"pt4": 0,
+}
+
+// pitchEnv adds the pitch envelope params to a synthdef and returns
+// the frequency ratio that the pitch envelope applies to every operator.
+// Like the amp envelope it holds its third level until the gate closes.
+func pitchEnv(p sc.Params, gate sc.Input) sc.Input {
+	var (
+		levels = make([]sc.Input, numEGSegments+1)
+		times  = make([]sc.Input, numEGSegments)
+	)
+	for i := range levels {
+		param := "pl" + strconv.Itoa(i)
+		levels[i] = p.Add(param, pitchEnvDefaults[param])
+	}
+	for i := range times {
+		param := "pt" + strconv.Itoa(i+1)
+		times[i] = p.Add(param, pitchEnvDefaults[param])
+	}
+	return sc.EnvGen{
+		Env: sc.Env{
+			Levels:      levels,
+			Times:       times,
+			ReleaseNode: sc.C(numEGSegments - 1),
+		},
+		Gate: gate,
+	}.Rate(sc.KR).Midiratio()
+}
+
+// pitchEnvCtrls returns the values of the pitch envelope params
+// for the segments of a DX7 pitch EG.
+func pitchEnvCtrls(segs [numEGSegments]sysex.EGSegment) map[string]float32 {
+	ctrls := map[string]float32{"pl0": float32(segs[0].From * 12)}
+
+	for i, seg := range segs {
+		n := strconv.Itoa(i + 1)
+		ctrls["pl"+n] = float32(seg.To * 12)
+		ctrls["pt"+n] = float32(seg.Time)
+	}
+	return ctrls
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/osc"
+	"github.com/scgolang/sc"
+)
+
+const (
+	// defaultGroupID is the default ID of the group that the synth
+	// nodes of the DX7 are added to.
+	defaultGroupID = 100
+
+	// statusTimeout is how long to wait for scsynth to reply to a status request.
+	statusTimeout = time.Second
+)
+
+var (
+	// connectAttempts is how many times Connect checks if scsynth is up.
+	connectAttempts = 6
+
+	// connectBackoff is how long Connect waits after the first attempt
+	// fails. It doubles after every attempt.
+	connectBackoff = 250 * time.Millisecond
+)
+
+// Connect connects to scsynth and adds a group for the synth nodes of the DX7.
+// scsynth may still be booting when the DX7 starts, so Connect waits
+// for it to reply to status requests, retrying with an increasing delay.
+// A group with the same ID that was left by an earlier run against a
+// scsynth that is still running is freed first, along with its nodes.
+// DX7s that share a scsynth need to be given different groups
+// with the -group flag.
+func (dx7 *DX7) Connect() error {
+	if err := waitForScsynth(dx7.scsynthAddr); err != nil {
+		return err
+	}
+	client, err := sc.NewClient("udp", dx7.localAddr, dx7.scsynthAddr, statusTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "connecting to scsynth at %s", dx7.scsynthAddr)
+	}
+	status, err := client.Status(statusTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "getting status of scsynth at %s", dx7.scsynthAddr)
+	}
+	// scsynth logs a failure when there is no group to free,
+	// but it does not reply to the client.
+	groupID := int32(dx7.groupID)
+	if err := client.NodeFree(groupID); err != nil {
+		return errors.Wrap(err, "freeing group")
+	}
+	group, err := client.Group(groupID, sc.AddToTail, sc.RootNodeID)
+	if err != nil {
+		return errors.Wrap(err, "adding group")
+	}
+	dx7.client = client
+	dx7.group = group
+	dx7.voices = newVoices(client, groupID, dx7.numVoices(), dx7.steal)
+
+	logger.Printf("connected to scsynth at %s (%d synths, %.1f%% cpu)\n", dx7.scsynthAddr, status.NumSynths, status.AvgCPU)
+
+	return nil
+}
+
+// waitForScsynth waits until scsynth replies to a status request.
+// It probes scsynth with its own socket instead of an sc.Client
+// because a client stops receiving replies once it has gotten an
+// error from a server that was not up.
+func waitForScsynth(addr string) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "resolving scsynth address")
+	}
+	backoff := connectBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := ping(raddr)
+		if err == nil {
+			return nil
+		}
+		if attempt == connectAttempts {
+			return errors.Wrapf(err, "scsynth at %s is not responding after %d attempts (is it running?)", addr, attempt)
+		}
+		logger.Printf("waiting for scsynth at %s: %s (retrying in %s)\n", addr, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// ping sends a status request to scsynth and waits for the reply.
+func ping(raddr *net.UDPAddr) error {
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write(osc.Message{Address: "/status"}.Bytes()); err != nil {
+		return err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(statusTimeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		msg, err := osc.ParseMessage(buf[:n], raddr)
+		if err != nil {
+			continue
+		}
+		if msg.Address == "/status.reply" {
+			return nil
+		}
+	}
+}
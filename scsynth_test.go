@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scgolang/osc"
+)
+
+// fakeScsynth replies to status requests like scsynth, after
+// ignoring the first few of them.
+// The addresses of all other messages are sent to received.
+func fakeScsynth(t *testing.T, ignore int) (addr string, received <-chan string, stop func()) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := osc.Message{
+		Address: "/status.reply",
+		Arguments: osc.Arguments{
+			osc.Int(32), osc.Int(0), osc.Int(2), osc.Int(32),
+			osc.Float(0.5), osc.Float(1), osc.Float(48000), osc.Float(48000),
+			osc.Float(0),
+		},
+	}
+	addrs := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, sender, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			msg, err := osc.ParseMessage(buf[:n], sender)
+			if err != nil {
+				continue
+			}
+			if msg.Address != "/status" {
+				addrs <- msg.Address
+				continue
+			}
+			if ignore > 0 {
+				ignore--
+				continue
+			}
+			_, _ = conn.WriteToUDP(reply.Bytes(), sender)
+		}
+	}()
+	return conn.LocalAddr().String(), addrs, func() { _ = conn.Close() }
+}
+
+func TestWaitForScsynth(t *testing.T) {
+	defer func(backoff time.Duration) { connectBackoff = backoff }(connectBackoff)
+	connectBackoff = time.Millisecond
+
+	// The first request times out, so waitForScsynth has to retry.
+	addr, _, stop := fakeScsynth(t, 1)
+	defer stop()
+
+	if err := waitForScsynth(addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	addr, received, stop := fakeScsynth(t, 0)
+	defer stop()
+
+	dx7 := &DX7{groupID: 200, localAddr: "127.0.0.1:0", scsynthAddr: addr}
+
+	if err := dx7.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if dx7.client == nil {
+		t.Fatal("expected a client")
+	}
+	if expected, got := int32(200), dx7.group.ID(); expected != got {
+		t.Fatalf("expected group %d, got %d", expected, got)
+	}
+	// A group left by an earlier run is freed before the group is added.
+	for _, expected := range []string{"/n_free", "/g_new"} {
+		select {
+		case got := <-received:
+			if expected != got {
+				t.Fatalf("expected %s, got %s", expected, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %s", expected)
+		}
+	}
+}
+
+func TestWaitForScsynthErrors(t *testing.T) {
+	defer func(attempts int, backoff time.Duration) {
+		connectAttempts, connectBackoff = attempts, backoff
+	}(connectAttempts, connectBackoff)
+
+	connectAttempts, connectBackoff = 1, time.Millisecond
+
+	addr, _, stop := fakeScsynth(t, 1)
+	stop()
+
+	if err := waitForScsynth(addr); err == nil {
+		t.Fatal("expected error when scsynth is not running")
+	}
+	if err := waitForScsynth("not an address"); err == nil {
+		t.Fatal("expected error for bad address")
+	}
+}
@@ -1,80 +1,58 @@
 package main
 
 import (
-	"fmt"
-
+	"github.com/pkg/errors"
 	"github.com/scgolang/sc"
 )
 
-var synthdefs = map[string]sc.UgenFunc{
-	"dx7_algo1": func(p sc.Params) sc.Ugen {
-		gate, bus := p.Add("gate", 1), sc.C(0)
-		op6 := NewOperator(6, p, gate, nil)
-		op5 := NewOperator(5, p, gate, op6)
-		op4 := NewOperator(4, p, gate, op5)
-		op3 := NewOperator(3, p, gate, op4)
-		op2 := NewOperator(2, p, gate, nil)
-		op1 := NewOperator(1, p, gate, op2)
-		sig := op1.Add(op3)
-		sig = sc.Multi(sig, sig)
-		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
-	},
-	"dx7_algo3": func(p sc.Params) sc.Ugen {
-		gate, bus := p.Add("gate", 1), sc.C(0)
-		op6 := NewOperator(6, p, gate, nil)
-		op5 := NewOperator(5, p, gate, op6)
-		op4 := NewOperator(4, p, gate, op5)
-		op3 := NewOperator(3, p, gate, nil)
-		op2 := NewOperator(2, p, gate, op3)
-		op1 := NewOperator(1, p, gate, op2)
-		sig := op1.Add(op4)
-		sig = sc.Multi(sig, sig)
-		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
-	},
-	"dx7_algo5": func(p sc.Params) sc.Ugen {
-		gate, bus := p.Add("gate", 1), sc.C(0)
-		op6 := NewOperator(6, p, gate, nil)
-		op5 := NewOperator(5, p, gate, op6)
-		op4 := NewOperator(4, p, gate, nil)
-		op3 := NewOperator(3, p, gate, op4)
-		op2 := NewOperator(2, p, gate, nil)
-		op1 := NewOperator(1, p, gate, op2)
-		sig := sc.Mix(sc.AR, []sc.Input{op1, op3, op5})
-		sig = sc.Multi(sig, sig)
-		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
-	},
-	"dx7_algo23": func(p sc.Params) sc.Ugen {
-		gate, bus := p.Add("gate", 1), sc.C(0)
-		op6 := NewOperator(6, p, gate, nil)
-		op5 := NewOperator(5, p, gate, op6)
-		op4 := NewOperator(4, p, gate, op6)
-		op3 := NewOperator(3, p, gate, nil)
-		op2 := NewOperator(2, p, gate, op3)
-		op1 := NewOperator(1, p, gate, nil)
-		sig := sc.Mix(sc.AR, []sc.Input{op1, op2, op4, op5})
-		sig = sc.Multi(sig, sig)
-		return sc.Out{Bus: bus, Channels: sig}.Rate(sc.AR)
-	},
+// synthdefs maps synthdef names to the functions that create them.
+// There is one synthdef for every algorithm.
+var synthdefs = map[string]sc.UgenFunc{}
+
+// userAlgorithms maps names to user-defined algorithms.
+var userAlgorithms = map[string]*Algorithm{}
+
+func init() {
+	for i, algo := range algorithms {
+		synthdefs[defName(i+1)] = algo.UgenFunc()
+	}
 }
 
-// We don't have feedback yet, so alias algorithms with
-// feedback to their no-feedback versions.
-var synthdefAliases = map[string]string{
-	"dx7_algo2": "dx7_algo1",
-	"dx7_algo4": "dx7_algo3",
-	"dx7_algo6": "dx7_algo5",
+// getDefName gets a synthdef name from an algorithm number (1-32).
+func getDefName(algo int) (string, error) {
+	def := defName(algo)
+	if _, ok := synthdefs[def]; !ok {
+		return "", errors.Errorf("no synthdef for algorithm %d", algo)
+	}
+	return def, nil
 }
 
-// getDefName gets a synthdef name from an algorithm number.
-func getDefName(algo int8) string {
-	def := fmt.Sprintf("dx7_algo%d", algo)
+// addAlgorithm adds a user-defined algorithm and its synthdef.
+func addAlgorithm(algo Algorithm) error {
+	if err := algo.Validate(); err != nil {
+		return err
+	}
+	def := algo.DefName()
 	if _, ok := synthdefs[def]; ok {
-		return def
+		return errors.Errorf("algorithm %s already exists", algo.Name)
+	}
+	synthdefs[def] = algo.UgenFunc()
+	userAlgorithms[algo.Name] = &algo
+	return nil
+}
+
+// findAlgorithm finds an algorithm by name.
+// The DX7 algorithms are named 1 to 32.
+func findAlgorithm(name string) (*Algorithm, error) {
+	for i := range algorithms {
+		if algorithms[i].Name == name {
+			return &algorithms[i], nil
+		}
 	}
-	if alias, ok := synthdefAliases[def]; ok {
-		return alias
+	if algo, ok := userAlgorithms[name]; ok {
+		return algo, nil
 	}
-	panic(fmt.Sprintf("No synthdef for algorithm %d", algo))
+	return nil, errors.Errorf("no algorithm named %s", name)
 }
 
 // SendSynthdefs sends all the synthdefs needed for the DX7.
@@ -1,19 +1,62 @@
 package sysex
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+)
 
 const (
 	bulkDumpLength            = 4096
+	numVoices                 = 32
+	voiceDataLength           = 128
 	numOps                    = 6
 	opDataLength              = 17
 	kbdLevelScalingDataLength = 4
+	egDataLength              = 8
+	lfoDataLength             = 5
+	nameLength                = 10
 )
 
 // Common errors.
 var (
-	ErrInvalidLength = fmt.Errorf("bulk dump must be %d bytes in length", bulkDumpLength)
+	ErrInvalidLength      = fmt.Errorf("bulk dump must be %d bytes in length", bulkDumpLength)
+	ErrInvalidVoiceLength = fmt.Errorf("packed voice must be %d bytes in length", voiceDataLength)
 )
 
+// Bank is a cartridge of 32 DX7 voices, as transmitted
+// in a 32-voice bulk dump (format 9).
+type Bank [numVoices]*BulkDump
+
+// NewBank creates a new Bank from the data bytes of a 32-voice bulk dump.
+func NewBank(data []byte) (*Bank, error) {
+	if len(data) != bulkDumpLength {
+		return nil, ErrInvalidLength
+	}
+	bank := &Bank{}
+	for i := range bank {
+		voice, err := NewBulkDump(data[i*voiceDataLength : (i+1)*voiceDataLength])
+		if err != nil {
+			return nil, err
+		}
+		bank[i] = voice
+	}
+	return bank, nil
+}
+
+// Bytes encodes the bank as the data bytes of a 32-voice bulk dump.
+// Empty slots in the bank are encoded as zeroes.
+func (bank *Bank) Bytes() []byte {
+	data := make([]byte, 0, bulkDumpLength)
+	for _, voice := range bank {
+		if voice == nil {
+			data = append(data, make([]byte, voiceDataLength)...)
+			continue
+		}
+		data = append(data, voice.Packed()...)
+	}
+	return data
+}
+
 // BulkDump contains 155 parameters for a DX7 voice.
 type BulkDump struct {
 	// Ops is the list of operators that define the voice.
@@ -24,9 +67,9 @@ type BulkDump struct {
 
 	// Algorithm determines the modulation routing for
 	// the 6 operators.
-	Algorithm int8 `json:"algorithm" xml:"algorithm,attr""`
+	Algorithm int8 `json:"algorithm" xml:"algorithm,attr"`
 
-	// OscKeySync
+	// OscKeySync restarts the oscillators on every key press (0=off, 1=on).
 	OscKeySync int8 `json:"osc_key_sync" xml:"osc_key_sync,attr"`
 
 	// Feedback adjusts the amount of feedback for
@@ -42,31 +85,87 @@ type BulkDump struct {
 
 	// Name is the voice's name.
 	Name string `json:"name" xml:"name,attr"`
+
+	// unused holds the bits of a packed voice that are not
+	// covered by any parameter, so that encoding a decoded
+	// voice reproduces the original data.
+	unused [voiceDataLength]byte
 }
 
-// NewBulkDump creates a new BulkDump from a byte slice.
+// NewBulkDump creates a new BulkDump from a single 128-byte
+// packed voice of a 32-voice bulk dump.
 func NewBulkDump(data []byte) (*BulkDump, error) {
-	if len(data) != bulkDumpLength {
-		return nil, ErrInvalidLength
+	if len(data) != voiceDataLength {
+		return nil, ErrInvalidVoiceLength
 	}
 	ops := make([]*Op, numOps)
 	for i, j := numOps, 0; i > 0; i-- {
-		ops[i-1] = NewOp(data[j*opDataLength : (j*opDataLength)+opDataLength])
+		op, err := NewOp(data[j*opDataLength : (j*opDataLength)+opDataLength])
+		if err != nil {
+			return nil, err
+		}
+		ops[i-1] = op
 		j++
 	}
 
 	offset := opDataLength * numOps
 
-	return &BulkDump{
+	pitchEG, err := NewEG(data[offset : offset+egDataLength])
+	if err != nil {
+		return nil, err
+	}
+	lfo, err := NewLFO(data[offset+10 : offset+10+lfoDataLength])
+	if err != nil {
+		return nil, err
+	}
+	bd := &BulkDump{
 		Ops:        ops,
-		PitchEG:    NewEG(data[offset : offset+8]),
+		PitchEG:    pitchEG,
 		Algorithm:  int8(data[offset+8] & 0x1F),
-		OscKeySync: int8(data[offset+9] & 0x08),
+		OscKeySync: getOscKeySync(data[offset+9]),
 		Feedback:   int8(data[offset+9] & 0x07),
-		LFO:        NewLFO(data[offset+10 : offset+15]),
+		LFO:        lfo,
 		Transpose:  int8(data[offset+15]),
-		Name:       string(data[offset+16 : offset+26]),
-	}, nil
+		Name:       string(data[offset+16 : offset+16+nameLength]),
+	}
+	for i, b := range bd.Packed() {
+		bd.unused[i] = data[i] &^ b
+	}
+	return bd, nil
+}
+
+// Packed encodes the voice in the 128-byte packed format
+// used by 32-voice bulk dumps.
+func (bd *BulkDump) Packed() []byte {
+	data := make([]byte, voiceDataLength)
+	for i, j := numOps, 0; i > 0; i-- {
+		if i <= len(bd.Ops) && bd.Ops[i-1] != nil {
+			copy(data[j*opDataLength:], bd.Ops[i-1].packed())
+		}
+		j++
+	}
+
+	offset := opDataLength * numOps
+
+	copy(data[offset:], bd.PitchEG.bytes())
+	data[offset+8] = byte(bd.Algorithm) & 0x1F
+	data[offset+9] = (byte(bd.OscKeySync)&0x01)<<3 | byte(bd.Feedback)&0x07
+	copy(data[offset+10:], bd.LFO.packed())
+	data[offset+15] = byte(bd.Transpose)
+	copy(data[offset+16:], paddedName(bd.Name))
+
+	for i, b := range bd.unused {
+		data[i] |= b
+	}
+	return data
+}
+
+// paddedName returns a voice name as exactly 10 bytes,
+// padded with spaces if it is too short.
+func paddedName(name string) []byte {
+	b := bytes.Repeat([]byte{' '}, nameLength)
+	copy(b, name)
+	return b
 }
 
 // Op contains all the parameters for a single operator.
@@ -91,7 +190,8 @@ type Op struct {
 	// the output level of the operator).
 	KbdVelocitySensitivity int8 `json:"kbd_velocity_sensitivity" xml:"kbd_velocity_sensitivity,attr"`
 
-	// AmpModSensitivity not really sure what this does (briansorahan).
+	// AmpModSensitivity sets how much the LFO's amp modulation
+	// attenuates the operator (0-3).
 	AmpModSensitivity int8 `json:"amp_mod_sensitivity" xml:"amp_mod_sensitivity,attr"`
 
 	// Oscillator corresponds to the oscillator section on
@@ -100,11 +200,22 @@ type Op struct {
 }
 
 // NewOp creates a new Op from a byte slice.
-// A runtime panic occurs if data is less than 17 bytes long.
-func NewOp(data []byte) *Op {
+// ErrTruncated is returned if data is less than 17 bytes long.
+func NewOp(data []byte) (*Op, error) {
+	if err := checkLength(data, opDataLength); err != nil {
+		return nil, err
+	}
+	ampEG, err := NewEG(data[0:egDataLength])
+	if err != nil {
+		return nil, err
+	}
+	kls, err := NewKbdLevelScaling(data[8 : 8+kbdLevelScalingDataLength])
+	if err != nil {
+		return nil, err
+	}
 	return &Op{
-		AmpEG:                  NewEG(data[0:8]),
-		KbdLevelScaling:        NewKbdLevelScaling(data[8:12]),
+		AmpEG:                  ampEG,
+		KbdLevelScaling:        kls,
 		KbdRateScaling:         int8(data[12] & 0x07),
 		KbdVelocitySensitivity: getKbdVelSens(data[13]),
 		AmpModSensitivity:      int8(data[13] & 0x03),
@@ -115,7 +226,20 @@ func NewOp(data []byte) *Op {
 			FreqFine:   int8(data[16]),
 			Detune:     getOscDetune(data[12]),
 		},
-	}
+	}, nil
+}
+
+// packed encodes the op in the 17-byte packed format.
+func (op *Op) packed() []byte {
+	data := make([]byte, opDataLength)
+	copy(data[0:egDataLength], op.AmpEG.bytes())
+	copy(data[8:8+kbdLevelScalingDataLength], op.KbdLevelScaling.packed())
+	data[12] = (byte(op.Oscillator.Detune)&0x0F)<<3 | byte(op.KbdRateScaling)&0x07
+	data[13] = (byte(op.KbdVelocitySensitivity)&0x07)<<2 | byte(op.AmpModSensitivity)&0x03
+	data[14] = byte(op.OutputLevel)
+	data[15] = (byte(op.Oscillator.FreqCoarse)&0x1F)<<1 | byte(op.Oscillator.Mode)&0x01
+	data[16] = byte(op.Oscillator.FreqFine)
+	return data
 }
 
 // Oscillator contains the oscillator parameters of a DX7 voice.
@@ -174,14 +298,27 @@ type KbdLevelScaling struct {
 }
 
 // NewKbdLevelScaling creates a new KbdLevelScaling from a byte slice.
-// A runtime panic occurs if data is less than 4 bytes long.
-func NewKbdLevelScaling(data []byte) KbdLevelScaling {
+// ErrTruncated is returned if data is less than 4 bytes long.
+func NewKbdLevelScaling(data []byte) (KbdLevelScaling, error) {
+	if err := checkLength(data, kbdLevelScalingDataLength); err != nil {
+		return KbdLevelScaling{}, err
+	}
 	return KbdLevelScaling{
 		Breakpoint: int8(data[0]),
 		Ldepth:     int8(data[1]),
 		Rdepth:     int8(data[2]),
 		Lcurve:     int8(data[3] & 0x03),
 		Rcurve:     getRcurve(data[3]),
+	}, nil
+}
+
+// packed encodes keyboard level scaling in the 4-byte packed format.
+func (kls KbdLevelScaling) packed() []byte {
+	return []byte{
+		byte(kls.Breakpoint),
+		byte(kls.Ldepth),
+		byte(kls.Rdepth),
+		(byte(kls.Rcurve)&0x03)<<2 | byte(kls.Lcurve)&0x03,
 	}
 }
 
@@ -190,6 +327,12 @@ func getRcurve(b byte) int8 {
 	return int8((0x0C & b) >> 2)
 }
 
+// getOscKeySync gets the oscillator key sync flag from the
+// byte that it shares with feedback.
+func getOscKeySync(b byte) int8 {
+	return int8((0x08 & b) >> 3)
+}
+
 // getOscDetune gets Oscillator Detune from a byte.
 func getOscDetune(b byte) int8 {
 	return int8((0x78 & b) >> 3)
@@ -220,8 +363,11 @@ type EG struct {
 }
 
 // NewEG creates a new EG from a byte slice.
-// A runtime panic occurs if data is less than 8 bytes long.
-func NewEG(data []byte) EG {
+// ErrTruncated is returned if data is less than 8 bytes long.
+func NewEG(data []byte) (EG, error) {
+	if err := checkLength(data, egDataLength); err != nil {
+		return EG{}, err
+	}
 	return EG{
 		R1: int8(data[0]),
 		R2: int8(data[1]),
@@ -231,6 +377,20 @@ func NewEG(data []byte) EG {
 		L2: int8(data[5]),
 		L3: int8(data[6]),
 		L4: int8(data[7]),
+	}, nil
+}
+
+// bytes encodes an EG as 4 rates followed by 4 levels.
+func (eg EG) bytes() []byte {
+	return []byte{
+		byte(eg.R1),
+		byte(eg.R2),
+		byte(eg.R3),
+		byte(eg.R4),
+		byte(eg.L1),
+		byte(eg.L2),
+		byte(eg.L3),
+		byte(eg.L4),
 	}
 }
 
@@ -260,8 +420,11 @@ type LFO struct {
 }
 
 // NewLFO creates a new LFO from a byte slice.
-// A runtime panic occurs if data is less than 5 bytes long.
-func NewLFO(data []byte) LFO {
+// ErrTruncated is returned if data is less than 5 bytes long.
+func NewLFO(data []byte) (LFO, error) {
+	if err := checkLength(data, lfoDataLength); err != nil {
+		return LFO{}, err
+	}
 	return LFO{
 		Speed:         int8(data[0]),
 		Delay:         int8(data[1]),
@@ -270,6 +433,17 @@ func NewLFO(data []byte) LFO {
 		PMSensitivity: getPMSensitivity(data[4]),
 		Wave:          getWave(data[4]),
 		Sync:          int8(data[4] & 0x01),
+	}, nil
+}
+
+// packed encodes an LFO in the 5-byte packed format.
+func (lfo LFO) packed() []byte {
+	return []byte{
+		byte(lfo.Speed),
+		byte(lfo.Delay),
+		byte(lfo.PMD),
+		byte(lfo.AMD),
+		(byte(lfo.PMSensitivity)&0x07)<<4 | (byte(lfo.Wave)&0x07)<<1 | byte(lfo.Sync)&0x01,
 	}
 }
 
@@ -282,3 +456,11 @@ func getPMSensitivity(b byte) int8 {
 func getWave(b byte) int8 {
 	return int8((0x0E & b) >> 1)
 }
+
+// checkLength returns ErrTruncated if data is shorter than n bytes.
+func checkLength(data []byte, n int) error {
+	if len(data) < n {
+		return &ErrTruncated{Expected: n, Got: len(data)}
+	}
+	return nil
+}
@@ -45,3 +45,18 @@ func TestGetOscDetune(t *testing.T) {
 		}
 	}
 }
+
+func TestGetOscKeySync(t *testing.T) {
+	for _, tc := range []struct {
+		Input  byte
+		Output int8
+	}{
+		{0x07, int8(0)},
+		{0x08, int8(1)},
+		{0x0F, int8(1)},
+	} {
+		if expected, got := tc.Output, getOscKeySync(tc.Input); expected != got {
+			t.Fatalf("Expected %d, got %d", expected, got)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package sysex
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// FieldError describes a problem with a field of a JSON or XML
+// encoded sysex message, such as a field that is missing or a
+// field that does not exist.
+type FieldError struct {
+	// Path locates the field, e.g. data[3].ops[2].amp.r2
+	Path    string
+	Problem string
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Problem
+}
+
+// FieldErrors is a list of problems with the fields of an
+// encoded sysex message.
+type FieldErrors []*FieldError
+
+// Error implements the error interface.
+func (errs FieldErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// xmlNameType is the type of the XMLName field of a Sysex.
+var xmlNameType = reflect.TypeOf(xml.Name{})
+
+// add adds a FieldError.
+func (errs *FieldErrors) add(path, format string, args ...interface{}) {
+	*errs = append(*errs, &FieldError{Path: path, Problem: fmt.Sprintf(format, args...)})
+}
+
+// DecodeJSON decodes every sysex message in a stream of JSON
+// values, like the ones syxfmt writes.
+// Every field must be present, except for the voice of a bank
+// dump and the bank of a single voice dump, and fields that
+// do not exist are not allowed. Problems with the fields are
+// returned as FieldErrors.
+func DecodeJSON(r io.Reader) ([]*Sysex, error) {
+	var (
+		all []*Sysex
+		dec = json.NewDecoder(r)
+	)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return all, nil
+		} else if err != nil {
+			return nil, err
+		}
+		var tree interface{}
+		if err := json.Unmarshal(raw, &tree); err != nil {
+			return nil, err
+		}
+		var errs FieldErrors
+		checkJSON(tree, reflect.TypeOf(Sysex{}), "", &errs)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		syx := &Sysex{}
+		if err := json.Unmarshal(raw, syx); err != nil {
+			return nil, err
+		}
+		all = append(all, syx)
+	}
+}
+
+// checkJSON checks a decoded JSON value against the fields of a type.
+// A null struct is reported, even for a field that may be
+// omitted, since json.Unmarshal would decode it as zeros or
+// leave it nil.
+func checkJSON(val interface{}, t reflect.Type, path string, errs *FieldErrors) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if val == nil {
+			errs.add(path, "null value")
+			return
+		}
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return // json.Unmarshal reports type errors.
+		}
+		known := map[string]bool{}
+		for _, f := range fields(t, "json") {
+			known[f.name] = true
+			v, ok := obj[f.name]
+			if !ok {
+				if !f.optional {
+					errs.add(joinPath(path, f.name), "missing field")
+				}
+				continue
+			}
+			if f.typ != xmlNameType {
+				checkJSON(v, f.typ, joinPath(path, f.name), errs)
+			}
+		}
+		for name := range obj {
+			if !known[name] {
+				errs.add(joinPath(path, name), "unknown field")
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := val.([]interface{})
+		if !ok {
+			return
+		}
+		if t.Kind() == reflect.Array && len(arr) != t.Len() {
+			errs.add(path, "expected %d elements, got %d", t.Len(), len(arr))
+		}
+		for i, v := range arr {
+			checkJSON(v, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+// DecodeXML decodes every sysex element in a stream of XML,
+// like the one syxfmt writes.
+// Every attribute and element must be present, except for the
+// voice of a bank dump and the bank of a single voice dump,
+// and attributes or elements that do not exist are not allowed.
+// Problems with the fields are returned as FieldErrors.
+func DecodeXML(r io.Reader) ([]*Sysex, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		all []*Sysex
+		dec = xml.NewDecoder(bytes.NewReader(data))
+	)
+	for {
+		offset := dec.InputOffset()
+
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return all, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		node, err := readXMLNode(dec, start)
+		if err != nil {
+			return nil, err
+		}
+		var errs FieldErrors
+		checkXML(node, reflect.TypeOf(Sysex{}), node.name, &errs)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		// Decode the element again, this time into a Sysex.
+		syx := &Sysex{}
+		if err := xml.NewDecoder(bytes.NewReader(data[offset:])).Decode(syx); err != nil {
+			return nil, err
+		}
+		all = append(all, syx)
+	}
+}
+
+// xmlNode is an XML element with its attributes and child elements.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+}
+
+// readXMLNode reads the element that start opens.
+func readXMLNode(dec *xml.Decoder, start xml.StartElement) (*xmlNode, error) {
+	node := &xmlNode{name: start.Name.Local, attrs: start.Attr}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := readXMLNode(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		case xml.EndElement:
+			return node, nil
+		}
+	}
+}
+
+// checkXML checks an XML element against the fields of a type.
+func checkXML(node *xmlNode, t reflect.Type, path string, errs *FieldErrors) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	var (
+		knownAttrs = map[string]bool{}
+		knownElems = map[string]bool{}
+	)
+	for _, f := range fields(t, "xml") {
+		if f.attr {
+			knownAttrs[f.name] = true
+			if !f.optional && !node.hasAttr(f.name) {
+				errs.add(joinPath(path, f.name), "missing attribute")
+			}
+			continue
+		}
+		var (
+			names = strings.Split(f.name, ">")
+			outer = names[0]
+			elems = node.childrenNamed(outer)
+		)
+		knownElems[outer] = true
+
+		if len(elems) == 0 {
+			if !f.optional {
+				errs.add(joinPath(path, outer), "missing element")
+			}
+			continue
+		}
+		if len(names) == 1 {
+			checkXML(elems[0], f.typ, joinPath(path, outer), errs)
+			continue
+		}
+		// The field is a list of inner elements wrapped in an outer one.
+		var (
+			inner     = names[1]
+			outerPath = joinPath(path, outer)
+			items     = elems[0].childrenNamed(inner)
+			list      = f.typ
+		)
+		for list.Kind() == reflect.Ptr {
+			list = list.Elem()
+		}
+		for _, child := range elems[0].children {
+			if child.name != inner {
+				errs.add(joinPath(outerPath, child.name), "unknown element")
+			}
+		}
+		if list.Kind() == reflect.Array && len(items) != list.Len() {
+			errs.add(outerPath, "expected %d %s elements, got %d", list.Len(), inner, len(items))
+		}
+		for i, item := range items {
+			checkXML(item, list.Elem(), fmt.Sprintf("%s[%d]", joinPath(outerPath, inner), i), errs)
+		}
+	}
+	for _, attr := range node.attrs {
+		if !knownAttrs[attr.Name.Local] {
+			errs.add(joinPath(path, attr.Name.Local), "unknown attribute")
+		}
+	}
+	for _, child := range node.children {
+		if !knownElems[child.name] {
+			errs.add(joinPath(path, child.name), "unknown element")
+		}
+	}
+}
+
+// hasAttr reports whether the element has an attribute.
+func (node *xmlNode) hasAttr(name string) bool {
+	for _, attr := range node.attrs {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+// childrenNamed returns the child elements with a specific name.
+func (node *xmlNode) childrenNamed(name string) []*xmlNode {
+	var children []*xmlNode
+	for _, child := range node.children {
+		if child.name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// field describes how a struct field is encoded.
+type field struct {
+	name     string
+	typ      reflect.Type
+	attr     bool
+	optional bool
+}
+
+// fields returns the encoded fields of a struct type for
+// the json or xml encoding.
+// Fields that may be omitted from the encoding are optional.
+func fields(t reflect.Type, encoding string) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		var (
+			tag  = sf.Tag.Get(encoding)
+			opts = strings.Split(tag, ",")
+			f    = field{name: opts[0], typ: sf.Type}
+		)
+		if f.name == "-" {
+			continue
+		}
+		if sf.Type == xmlNameType {
+			if encoding == "xml" {
+				continue
+			}
+			f.optional = true
+		}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "attr":
+				f.attr = true
+			case "omitempty":
+				f.optional = true
+			}
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// joinPath appends the name of a field to a path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// UnmarshalXML decodes one voice of a bank.
+// Every voice element of a bank fills the next empty slot.
+func (bank *Bank) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	voice := &BulkDump{}
+	if err := d.DecodeElement(voice, &start); err != nil {
+		return err
+	}
+	for i := range bank {
+		if bank[i] == nil {
+			bank[i] = voice
+			return nil
+		}
+	}
+	return fmt.Errorf("bank can not hold more than %d voices", numVoices)
+}
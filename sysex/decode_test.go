@@ -0,0 +1,184 @@
+package sysex
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// decodeTestMessages returns a bank dump and a single voice dump.
+func decodeTestMessages(t *testing.T) []*Sysex {
+	data, err := ioutil.ReadFile(filepath.Join("..", "assets", "syx", "rom1a.syx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bank, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*Sysex{bank, NewVoiceDump(0, bank.Data[7])}
+}
+
+// marshalAll marshals sysex messages to sysex bytes.
+func marshalAll(t *testing.T, msgs []*Sysex) []byte {
+	buf := &bytes.Buffer{}
+	for _, syx := range msgs {
+		if _, err := syx.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var (
+		msgs = decodeTestMessages(t)
+		buf  = &bytes.Buffer{}
+		enc  = json.NewEncoder(buf)
+	)
+	for _, syx := range msgs {
+		if err := enc.Encode(syx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decoded, err := DecodeJSON(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshalAll(t, msgs), marshalAll(t, decoded)) {
+		t.Fatal("sysex decoded from json differs from the original")
+	}
+}
+
+func TestDecodeXML(t *testing.T) {
+	var (
+		msgs = decodeTestMessages(t)
+		buf  = &bytes.Buffer{}
+		enc  = xml.NewEncoder(buf)
+	)
+	for _, syx := range msgs {
+		if err := enc.Encode(syx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decoded, err := DecodeXML(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshalAll(t, msgs), marshalAll(t, decoded)) {
+		t.Fatal("sysex decoded from xml differs from the original")
+	}
+}
+
+func TestDecodeJSONFieldErrors(t *testing.T) {
+	msgs := decodeTestMessages(t)
+	data, err := json.Marshal(msgs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := strings.Replace(string(data), `"r2":`, `"rate2":`, 1)
+	s = strings.Replace(s, `"transpose":24,`, ``, 1)
+
+	_, err = DecodeJSON(strings.NewReader(s))
+
+	var errs FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected FieldErrors got %v", err)
+	}
+	expected := map[string]string{
+		"voice.ops[0].amp.r2":    "missing field",
+		"voice.ops[0].amp.rate2": "unknown field",
+		"voice.transpose":        "missing field",
+	}
+	if len(expected) != len(errs) {
+		t.Fatalf("Expected %d errors got %d: %s", len(expected), len(errs), errs)
+	}
+	for _, err := range errs {
+		if expected[err.Path] != err.Problem {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+}
+
+func TestDecodeJSONNull(t *testing.T) {
+	msgs := decodeTestMessages(t)
+
+	var bank, voice map[string]interface{}
+	for i, tree := range []*map[string]interface{}{&bank, &voice} {
+		data, err := json.Marshal(msgs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+	voices := bank["data"].([]interface{})
+	voices[0] = nil
+	voices[1].(map[string]interface{})["ops"].([]interface{})[2] = nil
+	voice["voice"] = nil
+
+	for _, testcase := range []struct {
+		tree     map[string]interface{}
+		expected []string
+	}{
+		{bank, []string{"data[0]", "data[1].ops[2]"}},
+		{voice, []string{"voice"}},
+	} {
+		data, err := json.Marshal(testcase.tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = DecodeJSON(bytes.NewReader(data))
+
+		var errs FieldErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("Expected FieldErrors got %v", err)
+		}
+		if len(testcase.expected) != len(errs) {
+			t.Fatalf("Expected %d errors got %d: %s", len(testcase.expected), len(errs), errs)
+		}
+		for i, err := range errs {
+			if testcase.expected[i] != err.Path || err.Problem != "null value" {
+				t.Fatalf("Unexpected error %s", err)
+			}
+		}
+	}
+}
+
+func TestDecodeXMLFieldErrors(t *testing.T) {
+	msgs := decodeTestMessages(t)
+	data, err := xml.Marshal(msgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := strings.Replace(string(data), ` r2=`, ` rate2=`, 1)
+	s = strings.Replace(s, `<lfo `, `<lfo shape="1" `, 1)
+	s = strings.Replace(s, `<pitch_eg l1="50" l2="50" l3="50" l4="50" r1="84" r2="95" r3="95" r4="60"></pitch_eg>`, ``, 1)
+
+	_, err = DecodeXML(strings.NewReader(s))
+
+	var errs FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected FieldErrors got %v", err)
+	}
+	expected := map[string]string{
+		"sysex.data.voice[0].ops.op[0].amp.r2":    "missing attribute",
+		"sysex.data.voice[0].ops.op[0].amp.rate2": "unknown attribute",
+		"sysex.data.voice[0].pitch_eg":            "missing element",
+		"sysex.data.voice[0].lfo.shape":           "unknown attribute",
+	}
+	if len(expected) != len(errs) {
+		t.Fatalf("Expected %d errors got %d: %s", len(expected), len(errs), errs)
+	}
+	for _, err := range errs {
+		if expected[err.Path] != err.Problem {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package sysex
+
+import "fmt"
+
+// ErrChecksum is returned when the checksum of a sysex
+// message does not match its data bytes.
+type ErrChecksum struct {
+	Expected byte
+	Got      byte
+}
+
+// Error implements the error interface.
+func (e *ErrChecksum) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected %X, got %X", e.Expected, e.Got)
+}
+
+// ErrFraming is returned when a sysex message does not
+// start with F0 or end with F7.
+type ErrFraming struct {
+	Expected byte
+	Got      byte
+}
+
+// Error implements the error interface.
+func (e *ErrFraming) Error() string {
+	return fmt.Sprintf("expected status byte %X, got %X", e.Expected, e.Got)
+}
+
+// ErrNotYamaha is returned when a sysex message was not
+// created by a Yamaha device.
+type ErrNotYamaha struct {
+	ManufacturerID byte
+}
+
+// Error implements the error interface.
+func (e *ErrNotYamaha) Error() string {
+	return fmt.Sprintf("Manufacturer is not Yamaha: %X", e.ManufacturerID)
+}
+
+// ErrTruncated is returned when a sysex message, or one
+// of the parameter blocks inside it, is too short.
+type ErrTruncated struct {
+	Expected int
+	Got      int
+}
+
+// Error implements the error interface.
+func (e *ErrTruncated) Error() string {
+	return fmt.Sprintf("truncated sysex data: expected %d bytes, only got %d", e.Expected, e.Got)
+}
+
+// ErrUnknownFormat is returned for sysex messages whose
+// format number is not a DX7 voice dump.
+type ErrUnknownFormat struct {
+	FormatNumber int
+}
+
+// Error implements the error interface.
+func (e *ErrUnknownFormat) Error() string {
+	return fmt.Sprintf("Unsupported format number: %d", e.FormatNumber)
+}
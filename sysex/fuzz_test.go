@@ -0,0 +1,65 @@
+package sysex
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fuzzSeeds returns the contents of every file in assets/syx.
+func fuzzSeeds(f *testing.F) [][]byte {
+	files, err := filepath.Glob(filepath.Join("..", "assets", "syx", "*.syx"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	seeds := make([][]byte, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		seeds = append(seeds, data)
+	}
+	return seeds
+}
+
+func FuzzNew(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		syx, err := New(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// Anything that parses must survive a round trip.
+		msg, err := syx.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := New(bytes.NewReader(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(syx, again) {
+			t.Fatalf("Expected %#v got %#v", syx, again)
+		}
+	})
+}
+
+func FuzzNewBulkDump(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed[headerLength : headerLength+voiceDataLength])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bd, err := NewBulkDump(data)
+		if err != nil {
+			return
+		}
+		if got := bd.Packed(); !bytes.Equal(data, got) {
+			t.Fatalf("Expected % X got % X", data, got)
+		}
+	})
+}
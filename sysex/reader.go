@@ -0,0 +1,109 @@
+package sysex
+
+import (
+	"bufio"
+	"io"
+)
+
+// Reader reads consecutive sysex messages from a stream,
+// such as a file that holds several dumps back to back,
+// a pipe, or a network connection.
+type Reader struct {
+	br   *bufio.Reader
+	opts Options
+}
+
+// NewReader creates a Reader that parses messages from r.
+func NewReader(r io.Reader, opts Options) *Reader {
+	return &Reader{br: bufio.NewReader(r), opts: opts}
+}
+
+// Next returns the next DX7 voice dump in the stream.
+// Bytes that are not part of a sysex message are skipped, as
+// are Yamaha messages that are not voice dumps (e.g. parameter
+// changes, or performance dumps and other bulk dump formats).
+// Messages from other manufacturers are skipped if opts.SkipForeign
+// is set and reported with ErrNotYamaha otherwise.
+// After an error the Reader is positioned at the end of the
+// offending message, so Next can be called again.
+// io.EOF is returned when the stream has no more messages.
+func (r *Reader) Next() (*Sysex, error) {
+	for {
+		if err := r.skipTo(sysexStart); err != nil {
+			return nil, err
+		}
+		hdr, err := r.br.Peek(4)
+		if err != nil {
+			// Discard the truncated header, so the next call
+			// returns io.EOF.
+			_, _ = r.br.Discard(len(hdr))
+			return nil, &ErrTruncated{Expected: headerLength, Got: len(hdr)}
+		}
+		var (
+			manufacturerID = hdr[1]
+			substatus      = getSubstatus(hdr[2])
+			formatNumber   = midiMask(hdr[3])
+		)
+		if manufacturerID == yamahaManufacturerID && substatus == 0 && isVoiceFormat(formatNumber) {
+			return NewWithOptions(r.br, r.opts)
+		}
+		if err := r.skipMessage(); err != nil {
+			return nil, err
+		}
+		if manufacturerID != yamahaManufacturerID && !r.opts.SkipForeign {
+			return nil, &ErrNotYamaha{ManufacturerID: manufacturerID}
+		}
+	}
+}
+
+// isVoiceFormat reports whether a bulk dump format number is
+// the format of a single voice dump or a bank dump.
+func isVoiceFormat(formatNumber int) bool {
+	return formatNumber == FormatSingleVoice || formatNumber == FormatBank
+}
+
+// ReadAll reads every DX7 voice dump that remains in the stream.
+func (r *Reader) ReadAll() ([]*Sysex, error) {
+	var all []*Sysex
+	for {
+		syx, err := r.Next()
+		if err == io.EOF {
+			return all, nil
+		}
+		if err != nil {
+			return all, err
+		}
+		all = append(all, syx)
+	}
+}
+
+// skipMessage discards a sysex message up to and including its F7.
+func (r *Reader) skipMessage() error {
+	if _, err := r.br.Discard(1); err != nil {
+		return err
+	}
+	if err := r.skipTo(sysexEnd); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	_, err := r.br.Discard(1)
+	return err
+}
+
+// skipTo discards bytes up to, but not including, the next b.
+func (r *Reader) skipTo(b byte) error {
+	for {
+		next, err := r.br.Peek(1)
+		if err != nil {
+			return err
+		}
+		if next[0] == b {
+			return nil
+		}
+		if _, err := r.br.Discard(1); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package sysex
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+// readerTestStream returns three banks back to back, with stray bytes,
+// a Roland message, a DX7 parameter change and a bulk dump that is
+// not a voice dump mixed in.
+func readerTestStream(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	for i, name := range []string{"rom1a.syx", "rom1b.syx", "rom2a.syx"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "assets", "syx", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = buf.Write(data)
+
+		if i == 0 {
+			_, _ = buf.Write([]byte{0x00, 0x7F, 0xFE})
+			_, _ = buf.Write([]byte{0xF0, 0x41, 0x10, 0x16, 0x12, 0x01, 0xF7})
+		}
+		if i == 1 {
+			_, _ = buf.Write([]byte{0xF0, 0x43, 0x10, 0x01, 0x06, 0x31, 0xF7})
+			// A bulk dump of a format that is not a voice dump.
+			_, _ = buf.Write([]byte{0xF0, 0x43, 0x00, 0x02, 0x00, 0x02, 0x01, 0x02, 0x7D, 0xF7})
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReaderSkipForeign(t *testing.T) {
+	stream := readerTestStream(t)
+	r := NewReader(iotest.OneByteReader(bytes.NewReader(stream)), Options{SkipForeign: true})
+	all, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, len(all); expected != got {
+		t.Fatalf("Expected %d messages got %d", expected, got)
+	}
+	for i, name := range []string{"BRASS   1 ", "PIANO   4 ", "PICCOLO   "} {
+		if expected, got := name, all[i].Data[0].Name; expected != got {
+			t.Fatalf("message %d: expected %q got %q", i, expected, got)
+		}
+	}
+}
+
+func TestReaderReportForeign(t *testing.T) {
+	r := NewReader(bytes.NewReader(readerTestStream(t)), Options{})
+
+	for i := 0; i < 4; i++ {
+		syx, err := r.Next()
+		if i == 1 {
+			var yamahaErr *ErrNotYamaha
+			if !errors.As(err, &yamahaErr) {
+				t.Fatalf("message %d: expected ErrNotYamaha got %v", i, err)
+			}
+			if expected, got := byte(0x41), yamahaErr.ManufacturerID; expected != got {
+				t.Fatalf("Expected manufacturer %X got %X", expected, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("message %d: %s", i, err)
+		}
+		if syx.Data == nil {
+			t.Fatalf("message %d: expected a bank", i)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("Expected io.EOF got %v", err)
+	}
+}
+
+func TestReaderTruncatedTail(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "assets", "syx", "rom1a.syx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(bytes.NewReader(append(data, 0xF0, 0x43)), Options{})
+
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	var truncated *ErrTruncated
+	if _, err := r.Next(); !errors.As(err, &truncated) {
+		t.Fatalf("Expected ErrTruncated got %v", err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("Expected io.EOF got %v", err)
+	}
+}
@@ -8,15 +8,23 @@ package sysex
 
 import (
 	"encoding/xml"
-	"fmt"
+	"errors"
 	"io"
 )
 
 const (
+	sysexStart           = 0xF0
+	sysexEnd             = 0xF7
 	yamahaManufacturerID = 0x43
 	headerLength         = 6
 )
 
+// Format numbers of DX7 voice dumps.
+const (
+	FormatSingleVoice = 0
+	FormatBank        = 9
+)
+
 // Sysex defines a MIDI sysex message.
 type Sysex struct {
 	XMLName      xml.Name  `xml:"sysex"`
@@ -24,18 +32,49 @@ type Sysex struct {
 	Channel      int       `json:"channel"            xml:"channel,attr"`
 	FormatNumber int       `json:"format_number"      xml:"format_number,attr"`
 	ByteCount    int16     `json:"byte_count"         xml:"byte_count,attr"`
-	Data         *BulkDump `json:"data"               xml:"data"`
+	Voice        *BulkDump `json:"voice,omitempty"    xml:"voice,omitempty"`
+	Data         *Bank     `json:"data,omitempty"     xml:"data>voice,omitempty"`
+
+	// Warnings holds the problems that were tolerated
+	// while parsing the message leniently.
+	Warnings []error `json:"-" xml:"-"`
+}
+
+// Options configure how sysex messages are parsed.
+type Options struct {
+	// Lenient causes a bad checksum or a missing F7 at the end
+	// of a message to be recorded in the Warnings of the parsed
+	// message instead of failing the parse.
+	// This allows damaged cartridges to be loaded.
+	Lenient bool
+
+	// SkipForeign causes a Reader to silently skip sysex
+	// messages from other manufacturers.
+	SkipForeign bool
 }
 
 // New parses a sysex message from an io.Reader.
+// The checksum and the framing of the message are strictly checked.
+// io.EOF is returned if r has no data at all.
 func New(r io.Reader) (*Sysex, error) {
+	return NewWithOptions(r, Options{})
+}
+
+// NewWithOptions parses a sysex message from an io.Reader
+// using the provided options.
+func NewWithOptions(r io.Reader, opts Options) (*Sysex, error) {
 	hdr := make([]byte, headerLength)
-	if _, err := r.Read(hdr); err != nil {
+	if err := readFull(r, hdr); err != nil {
+		if truncated, ok := err.(*ErrTruncated); ok && truncated.Got == 0 {
+			return nil, io.EOF
+		}
 		return nil, err
 	}
-
+	if hdr[0] != sysexStart {
+		return nil, &ErrFraming{Expected: sysexStart, Got: hdr[0]}
+	}
 	if hdr[1] != yamahaManufacturerID {
-		return nil, fmt.Errorf("Manufacturer is not Yamaha: %X", hdr[1])
+		return nil, &ErrNotYamaha{ManufacturerID: hdr[1]}
 	}
 
 	var (
@@ -45,24 +84,143 @@ func New(r io.Reader) (*Sysex, error) {
 			FormatNumber: midiMask(hdr[3]),
 			ByteCount:    getByteCount(hdr[4], hdr[5]),
 		}
-		data = make([]byte, syx.ByteCount)
+		data    = make([]byte, syx.ByteCount)
+		trailer = make([]byte, 2)
 	)
-
-	n, err := r.Read(data)
-	if err != nil {
+	if err := readFull(r, data); err != nil {
 		return nil, err
 	}
-	if int16(n) != syx.ByteCount {
-		return nil, fmt.Errorf("only read %d data bytes", n)
+	if err := readFull(r, trailer); err != nil {
+		if err := syx.tolerate(err, opts); err != nil {
+			return nil, err
+		}
+	} else if err := checkTrailer(data, trailer); err != nil {
+		if err := syx.tolerate(err, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	switch syx.FormatNumber {
+	default:
+		return nil, &ErrUnknownFormat{FormatNumber: syx.FormatNumber}
+	case FormatSingleVoice:
+		voice, err := NewVoice(data)
+		if err != nil {
+			return nil, err
+		}
+		syx.Voice = voice
+	case FormatBank:
+		bank, err := NewBank(data)
+		if err != nil {
+			return nil, err
+		}
+		syx.Data = bank
+	}
+	return syx, nil
+}
+
+// tolerate returns err unless lenient parsing was requested,
+// in which case err is recorded as a warning.
+func (syx *Sysex) tolerate(err error, opts Options) error {
+	if !opts.Lenient {
+		return err
+	}
+	syx.Warnings = append(syx.Warnings, err)
+	return nil
+}
+
+// checkTrailer checks the checksum and the F7 that follow
+// the data bytes of a sysex message.
+func checkTrailer(data, trailer []byte) error {
+	if expected := checksum(data); trailer[0] != expected {
+		return &ErrChecksum{Expected: expected, Got: trailer[0]}
 	}
+	if trailer[1] != sysexEnd {
+		return &ErrFraming{Expected: sysexEnd, Got: trailer[1]}
+	}
+	return nil
+}
+
+// readFull fills buf from r.
+// Running out of data before buf is full is reported as ErrTruncated.
+func readFull(r io.Reader, buf []byte) error {
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &ErrTruncated{Expected: len(buf), Got: n}
+	}
+	return err
+}
+
+// NewBankDump creates a 32-voice bulk dump (format 9) of a bank.
+func NewBankDump(channel int, bank *Bank) *Sysex {
+	return &Sysex{
+		Channel:      channel,
+		FormatNumber: FormatBank,
+		ByteCount:    bulkDumpLength,
+		Data:         bank,
+	}
+}
+
+// NewVoiceDump creates a single voice dump (format 0) of a voice.
+func NewVoiceDump(channel int, voice *BulkDump) *Sysex {
+	return &Sysex{
+		Channel:      channel,
+		FormatNumber: FormatSingleVoice,
+		ByteCount:    singleVoiceLength,
+		Voice:        voice,
+	}
+}
 
-	bulkDump, err := NewBulkDump(data)
+// Marshal encodes the sysex message, including the F0 and F7
+// framing bytes and the checksum.
+func (syx *Sysex) Marshal() ([]byte, error) {
+	var data []byte
+
+	switch syx.FormatNumber {
+	default:
+		return nil, &ErrUnknownFormat{FormatNumber: syx.FormatNumber}
+	case FormatSingleVoice:
+		if syx.Voice == nil {
+			return nil, errors.New("single voice dump has no voice")
+		}
+		data = syx.Voice.Unpacked()
+	case FormatBank:
+		if syx.Data == nil {
+			return nil, errors.New("bulk dump has no bank")
+		}
+		data = syx.Data.Bytes()
+	}
+	msg := make([]byte, 0, headerLength+len(data)+2)
+	msg = append(msg,
+		sysexStart,
+		yamahaManufacturerID,
+		byte(syx.Substatus&0x07)<<4|byte(syx.Channel&0x0F),
+		byte(midiMask(byte(syx.FormatNumber))),
+		byte(len(data)>>7)&0x7F,
+		byte(len(data))&0x7F,
+	)
+	msg = append(msg, data...)
+
+	return append(msg, checksum(data), sysexEnd), nil
+}
+
+// WriteTo writes the encoded sysex message to w.
+func (syx *Sysex) WriteTo(w io.Writer) (int64, error) {
+	msg, err := syx.Marshal()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	syx.Data = bulkDump
+	n, err := w.Write(msg)
+	return int64(n), err
+}
 
-	return syx, nil
+// checksum computes the 7-bit two's complement checksum of data bytes.
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return -sum & 0x7F
 }
 
 // getSubstatus gets the substatus value from a byte.
@@ -84,6 +242,7 @@ func midiMask(b byte) int {
 }
 
 // getByteCount gets the count of data bytes.
+// The count is made of two 7-bit data bytes, so it is never negative.
 func getByteCount(ms, ls byte) int16 {
-	return (int16(ms) << 7) + int16(ls)
+	return (int16(midiMask(ms)) << 7) + int16(midiMask(ls))
 }
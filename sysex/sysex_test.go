@@ -1,6 +1,15 @@
 package sysex
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
 
 func TestSubStatus(t *testing.T) {
 	for _, pair := range []struct {
@@ -86,3 +95,226 @@ func TestByteCount(t *testing.T) {
 		}
 	}
 }
+
+func TestNewBank(t *testing.T) {
+	f, err := os.Open(filepath.Join("..", "assets", "syx", "rom1a.syx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	syx, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if syx.Data == nil {
+		t.Fatal("Expected bank data, got nil")
+	}
+	for i, name := range []string{
+		"BRASS   1 ",
+		"BRASS   2 ",
+		"BRASS   3 ",
+		"STRINGS 1 ",
+		"STRINGS 2 ",
+		"STRINGS 3 ",
+		"ORCHESTRA ",
+		"PIANO   1 ",
+		"PIANO   2 ",
+		"PIANO   3 ",
+		"E.PIANO 1 ",
+		"GUITAR  1 ",
+		"GUITAR  2 ",
+		"SYN-LEAD 1",
+		"BASS    1 ",
+		"BASS    2 ",
+		"E.ORGAN 1 ",
+		"PIPES   1 ",
+		"HARPSICH 1",
+		"CLAV    1 ",
+		"VIBE    1 ",
+		"MARIMBA   ",
+		"KOTO      ",
+		"FLUTE   1 ",
+		"ORCH-CHIME",
+		"TUB BELLS ",
+		"STEEL DRUM",
+		"TIMPANI   ",
+		"REFS WHISL",
+		"VOICE   1 ",
+		"TRAIN     ",
+		"TAKE OFF  ",
+	} {
+		if expected, got := name, syx.Data[i].Name; expected != got {
+			t.Fatalf("voice %d: expected %q got %q", i, expected, got)
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "assets", "syx", "*.syx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no sysex files found")
+	}
+	for _, file := range files {
+		expected, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		syx, err := New(bytes.NewReader(expected))
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		got, err := syx.Marshal()
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		if !bytes.Equal(expected, got) {
+			t.Fatalf("%s: encoded bytes differ from the original", file)
+		}
+	}
+}
+
+func TestVoiceDumpRoundTrip(t *testing.T) {
+	f, err := os.Open(filepath.Join("..", "assets", "syx", "rom1a.syx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	bank, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, voice := range bank.Data {
+		buf := &bytes.Buffer{}
+		if _, err := NewVoiceDump(3, voice).WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := headerLength+singleVoiceLength+2, buf.Len(); expected != got {
+			t.Fatalf("voice %d: expected %d bytes got %d", i, expected, got)
+		}
+		syx, err := New(buf)
+		if err != nil {
+			t.Fatalf("voice %d: %s", i, err)
+		}
+		if expected, got := 3, syx.Channel; expected != got {
+			t.Fatalf("voice %d: expected channel %d got %d", i, expected, got)
+		}
+		if !reflect.DeepEqual(voice, syx.Voice) {
+			t.Fatalf("voice %d: expected %#v got %#v", i, voice, syx.Voice)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for _, val := range []struct {
+		Data []byte
+		Out  byte
+	}{
+		{[]byte{}, 0x00},
+		{[]byte{0x01}, 0x7F},
+		{[]byte{0x7F, 0x7F}, 0x02},
+		{[]byte{0x40, 0x40}, 0x00},
+	} {
+		if expected, got := val.Out, checksum(val.Data); expected != got {
+			t.Fatalf("Expected %X got %X", expected, got)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	valid, err := ioutil.ReadFile(filepath.Join("..", "assets", "syx", "rom1a.syx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(f func(b []byte) []byte) []byte {
+		b := make([]byte, len(valid))
+		copy(b, valid)
+		return f(b)
+	}
+	var (
+		checksumErr *ErrChecksum
+		framingErr  *ErrFraming
+		yamahaErr   *ErrNotYamaha
+		truncErr    *ErrTruncated
+		formatErr   *ErrUnknownFormat
+	)
+	for _, tc := range []struct {
+		Name    string
+		Data    []byte
+		Target  interface{}
+		Lenient bool
+	}{
+		{
+			Name:    "bad checksum",
+			Data:    corrupt(func(b []byte) []byte { b[len(b)-2]++; return b }),
+			Target:  &checksumErr,
+			Lenient: true,
+		},
+		{
+			Name:    "missing F7",
+			Data:    corrupt(func(b []byte) []byte { b[len(b)-1] = 0; return b }),
+			Target:  &framingErr,
+			Lenient: true,
+		},
+		{
+			Name:    "truncated trailer",
+			Data:    corrupt(func(b []byte) []byte { return b[:len(b)-2] }),
+			Target:  &truncErr,
+			Lenient: true,
+		},
+		{
+			Name:   "missing F0",
+			Data:   corrupt(func(b []byte) []byte { b[0] = 0; return b }),
+			Target: &framingErr,
+		},
+		{
+			Name:   "not yamaha",
+			Data:   corrupt(func(b []byte) []byte { b[1] = 0x41; return b }),
+			Target: &yamahaErr,
+		},
+		{
+			Name:   "truncated data",
+			Data:   corrupt(func(b []byte) []byte { return b[:100] }),
+			Target: &truncErr,
+		},
+		{
+			Name:   "unknown format",
+			Data:   corrupt(func(b []byte) []byte { b[3] = 0x05; return b }),
+			Target: &formatErr,
+		},
+	} {
+		_, err := New(bytes.NewReader(tc.Data))
+		if err == nil {
+			t.Fatalf("%s: expected an error", tc.Name)
+		}
+		if !errors.As(err, tc.Target) {
+			t.Fatalf("%s: unexpected error type %T", tc.Name, err)
+		}
+		syx, err := NewWithOptions(bytes.NewReader(tc.Data), Options{Lenient: true})
+		if !tc.Lenient {
+			if err == nil {
+				t.Fatalf("%s: expected an error in lenient mode", tc.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", tc.Name, err)
+		}
+		if expected, got := 1, len(syx.Warnings); expected != got {
+			t.Fatalf("%s: expected %d warning got %d", tc.Name, expected, got)
+		}
+		if !errors.As(syx.Warnings[0], tc.Target) {
+			t.Fatalf("%s: unexpected warning type %T", tc.Name, syx.Warnings[0])
+		}
+	}
+}
+
+func TestNewEmpty(t *testing.T) {
+	if _, err := New(bytes.NewReader(nil)); err != io.EOF {
+		t.Fatalf("Expected io.EOF got %v", err)
+	}
+}
@@ -0,0 +1,608 @@
+package sysex
+
+import "math"
+
+// The conversions in this file follow the tables and timing model of
+// the DX7 engine in Google's music-synthesizer-for-android (msfa),
+// which were reverse engineered from the original hardware and are
+// also used by Dexed.
+// https://github.com/google/music-synthesizer-for-android
+
+const (
+	// egSampleRate is the sample rate the EG timing model was measured at.
+	egSampleRate = 44100
+
+	// maxScaledLevel is the scaled value of an output level or EG level of 99.
+	maxScaledLevel = 127
+
+	// jumpLevel is the level an attack starts from when the
+	// EG is below it (in 1/256 octaves).
+	jumpLevel = 1716
+
+	// minLevel is the lowest level the EG ever reaches (in 1/256 octaves).
+	minLevel = 16
+
+	// lfoUnit is the LFO phase increment per second for every
+	// step of the LFO rate (in 1/2^32 cycles).
+	lfoUnit = 25190424
+)
+
+// egUnitDB is the size of a step of the internal EG level in dB.
+var egUnitDB = 20 * math.Log10(2) / 256
+
+// MaxModIndex is the modulation index (in radians) of an
+// operator at full output level with its EG at level 99.
+var MaxModIndex = 2 * math.Pi * math.Exp2(float64(egLevel(99))/256-14)
+
+// levelTable maps output levels below 20 to their scaled values.
+var levelTable = [20]int{
+	0, 5, 9, 13, 17, 20, 23, 25, 27, 29, 31, 33, 35, 37, 39, 41, 42, 43, 45, 46,
+}
+
+// pitchEGTable maps a pitch EG level (0-99) to a pitch shift
+// in 1/32 octaves.
+var pitchEGTable = [100]int8{
+	-128, -116, -104, -95, -85, -76, -68, -61, -56, -52, -49, -46, -43,
+	-41, -39, -37, -35, -33, -32, -31, -30, -29, -28, -27, -26, -25, -24,
+	-23, -22, -21, -20, -19, -18, -17, -16, -15, -14, -13, -12, -11, -10,
+	-9, -8, -7, -6, -5, -4, -3, -2, -1, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+	11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27,
+	28, 29, 30, 31, 32, 33, 34, 35, 38, 40, 43, 46, 49, 53, 58, 65, 73,
+	82, 92, 103, 115, 127,
+}
+
+// pitchEGRateTable maps a pitch EG rate (0-99) to the speed of the
+// pitch EG in 1/21.3 octaves per second.
+var pitchEGRateTable = [100]int{
+	1, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12,
+	13, 13, 14, 14, 15, 16, 16, 17, 18, 18, 19, 20, 21, 22, 23, 24, 25, 26,
+	27, 28, 30, 31, 33, 34, 36, 37, 38, 39, 41, 42, 44, 46, 47, 49, 51, 53,
+	54, 56, 58, 60, 62, 64, 66, 68, 70, 72, 74, 76, 79, 82, 85, 88, 91, 94,
+	98, 102, 106, 110, 115, 120, 125, 130, 135, 141, 147, 153, 159, 165,
+	171, 178, 185, 193, 202, 211, 232, 243, 254, 255,
+}
+
+// pitchModSensTable maps a pitch mod sensitivity (0-7) to a
+// fraction (in 1/255) of the maximum pitch modulation.
+var pitchModSensTable = [8]float64{0, 10, 20, 33, 55, 92, 153, 255}
+
+// ampModSensTable maps an amp mod sensitivity (0-3) to a
+// fraction (in 1/255) of the maximum amp modulation.
+var ampModSensTable = [4]float64{0, 66, 109, 255}
+
+// maxPitchMod is the pitch deviation (in octaves) of the LFO
+// at full depth and sensitivity.
+const maxPitchMod = 1
+
+// expScaleTable maps a distance from the breakpoint (in groups of
+// 3 notes) to the output level offset of an exponential keyboard
+// level scaling curve at full depth (in 1/8 steps).
+var expScaleTable = [33]int{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 11, 14, 16, 19, 23, 27, 33, 39, 47, 56, 66,
+	80, 94, 110, 126, 142, 158, 174, 190, 206, 222, 238, 250,
+}
+
+// velocityTable maps a MIDI velocity (in steps of 2) to the
+// change of an operator's level at full velocity sensitivity.
+// 239 is no change.
+var velocityTable = [64]int{
+	0, 70, 86, 97, 106, 114, 121, 126, 132, 138, 142, 148, 152, 156, 160, 163,
+	166, 170, 173, 174, 178, 181, 184, 186, 189, 190, 194, 196, 198, 200, 202,
+	205, 206, 209, 211, 214, 216, 218, 220, 222, 224, 225, 227, 229, 230, 232,
+	233, 235, 237, 238, 240, 241, 242, 243, 244, 246, 246, 248, 249, 250, 251,
+	252, 253, 254,
+}
+
+// Keyboard level scaling curves.
+const (
+	curveNegLin = iota
+	curveNegExp
+	curvePosExp
+	curvePosLin
+)
+
+// breakpointNote is the MIDI note of breakpoint 0 (A-1).
+const breakpointNote = 21
+
+// coarseRatio maps a coarse frequency value to a frequency ratio.
+// 0 is half the played frequency and the rest are harmonics.
+func coarseRatio(coarse int8) float64 {
+	if coarse == 0 {
+		return 0.5
+	}
+	return float64(coarse & 0x1F)
+}
+
+// scaleLevel maps an output level or EG level (0-99) to the
+// DX7's internal scale, on which every step is 0.75 dB.
+func scaleLevel(level int8) int {
+	if level < 0 {
+		level = 0
+	}
+	if level > 99 {
+		level = 99
+	}
+	if level < 20 {
+		return levelTable[level]
+	}
+	return 28 + int(level)
+}
+
+// OutputLevelGain converts an operator output level (0-99) to
+// a linear gain, where 99 is 1 and 0 is silent.
+// Every step of the level is 0.75 dB.
+func OutputLevelGain(level int8) float64 {
+	if level <= 0 {
+		return 0
+	}
+	return math.Exp2(float64(scaleLevel(level)-maxScaledLevel) / 8)
+}
+
+// EGLevelGain converts an EG level (0-99) to a linear gain,
+// where 99 is 1 and 0 is silent.
+// EG levels have half the resolution of output levels.
+func EGLevelGain(level int8) float64 {
+	if level <= 0 {
+		return 0
+	}
+	return math.Exp2(float64(egLevel(level)-egLevel(99)) / 256)
+}
+
+// EGLevelDB converts an EG level (0-99) to dB relative to level 99.
+// Level 0 is about -90 dB.
+func EGLevelDB(level int8) float64 {
+	return float64(egLevel(level)-egLevel(99)) * egUnitDB
+}
+
+// egLevel converts an EG level (0-99) to the level the EG
+// moves to internally, in 1/256 octaves.
+func egLevel(level int8) int {
+	actual := ((scaleLevel(level) >> 1) << 6) + (maxScaledLevel << 5) - 4256
+	if actual < minLevel {
+		return minLevel
+	}
+	return actual
+}
+
+// egIncrement returns how far the EG moves per sample at a
+// given rate (0-99), in 1/256 octaves.
+// rateScaling is the additional rate computed from keyboard
+// rate scaling, 0 if there is none.
+func egIncrement(rate int8, rateScaling int) float64 {
+	qrate := ((int(rate) * 41) >> 6) + rateScaling
+	if qrate > 63 {
+		qrate = 63
+	}
+	if qrate < 0 {
+		qrate = 0
+	}
+	inc := (4 + (qrate & 3)) << uint(2+(qrate>>2))
+	return float64(inc) / 65536
+}
+
+// EGTime returns the time (in seconds) the DX7 EG takes to move
+// from one level to another at a specific rate.
+// Levels and rate are in the range 0-99.
+// When an EG falls it moves at a constant speed in dB, but
+// when it rises it starts fast and slows down as it approaches
+// full level, and it jumps immediately to about -50dB first.
+func EGTime(rate, from, to int8) float64 {
+	return egTime(rate, 0, from, to)
+}
+
+// egTime is EGTime with a keyboard rate scaling offset.
+func egTime(rate int8, rateScaling int, from, to int8) float64 {
+	var (
+		inc = egIncrement(rate, rateScaling)
+		a   = float64(egLevel(from))
+		b   = float64(egLevel(to))
+	)
+	if b <= a {
+		return (a - b) / inc / egSampleRate
+	}
+	if a < jumpLevel {
+		a = jumpLevel
+	}
+	// While rising the increment is multiplied by 16 minus
+	// the integer part of the level in octaves.
+	var samples float64
+	for a < b {
+		var (
+			octave = math.Floor(a / 256)
+			end    = math.Min(b, (octave+1)*256)
+		)
+		samples += (end - a) / (inc * egRiseMult(int(a)))
+		a = end
+	}
+	return samples / egSampleRate
+}
+
+// EGSegment is one of the four segments of a DX7 EG.
+// Levels are in dB relative to EG level 99 for amp EGs
+// (see Segments) and in octaves for pitch EGs (see PitchSegments).
+type EGSegment struct {
+	// From is the level the segment starts at.
+	// When an amp EG rises from below about -50 dB it jumps there
+	// first, so From can be higher than the level of the previous segment.
+	From float64
+
+	// To is the level the segment ends at.
+	To float64
+
+	// Time is the duration of the segment (in seconds).
+	Time float64
+
+	// Speedup is how many times faster (in dB per second) the
+	// level moves at the start of the segment than at its end.
+	// It is 1 for segments that do not rise.
+	Speedup float64
+}
+
+// Segments returns the four segments of the EG: L4 to L1 at R1,
+// L1 to L2 at R2, L2 to L3 at R3, and L3 to L4 at R4.
+// A key can be released before the EG reaches L3, so the time of
+// the last segment is the longest time R4 takes to move to L4 from
+// any level the EG reaches while the key is held.
+// rateScaling is the additional rate computed from keyboard
+// rate scaling, 0 if there is none.
+func (eg EG) Segments(rateScaling int) [4]EGSegment {
+	var (
+		rates  = [4]int8{eg.R1, eg.R2, eg.R3, eg.R4}
+		levels = [5]int8{eg.L4, eg.L1, eg.L2, eg.L3, eg.L4}
+		segs   [4]EGSegment
+	)
+	for i, rate := range rates {
+		var (
+			from = levels[i]
+			to   = levels[i+1]
+			a    = egLevel(from)
+			b    = egLevel(to)
+			seg  = EGSegment{
+				From:    EGLevelDB(from),
+				To:      EGLevelDB(to),
+				Time:    egTime(rate, rateScaling, from, to),
+				Speedup: 1,
+			}
+		)
+		if b > a {
+			// An EG that jumps past its target reaches it immediately.
+			a = int(math.Min(float64(b), math.Max(float64(a), jumpLevel)))
+			if b > a {
+				seg.Speedup = egRiseMult(a) / egRiseMult(b-1)
+			}
+			seg.From = float64(a-egLevel(99)) * egUnitDB
+		}
+		segs[i] = seg
+	}
+	segs[3].Time = eg.releaseTime(rateScaling)
+	return segs
+}
+
+// releaseTime returns the longest time (in seconds) the EG takes to
+// move to L4 at R4 after the key is released. The EG can be at any
+// level between L4 and L1, L2 or L3 when the key is released, so
+// even an EG whose L3 equals L4 takes time to release.
+func (eg EG) releaseTime(rateScaling int) float64 {
+	var release float64
+	for _, level := range []int8{eg.L1, eg.L2, eg.L3} {
+		release = math.Max(release, egTime(eg.R4, rateScaling, level, eg.L4))
+	}
+	return release
+}
+
+// egRiseMult returns how many times faster than its rate a
+// rising EG moves at a level (in 1/256 octaves).
+func egRiseMult(level int) float64 {
+	return math.Max(1, 16-math.Floor(float64(level)/256))
+}
+
+// PitchEGLevel converts a pitch EG level (0-99) to a pitch
+// shift in octaves. 50 is no shift, 0 is 4 octaves down and 99
+// is almost 4 octaves up. The steps are smallest around 50.
+func PitchEGLevel(level int8) float64 {
+	if level < 0 {
+		level = 0
+	}
+	if level > 99 {
+		level = 99
+	}
+	return float64(pitchEGTable[level]) / 32
+}
+
+// PitchEGTime returns the time (in seconds) the DX7 pitch EG takes
+// to move from one level to another at a specific rate.
+// Levels and rate are in the range 0-99.
+// Unlike the amp EG the pitch EG moves at a constant speed in octaves.
+func PitchEGTime(rate, from, to int8) float64 {
+	return math.Abs(PitchEGLevel(to)-PitchEGLevel(from)) / pitchEGSpeed(rate)
+}
+
+// pitchEGSpeed returns the speed (in octaves per second) of the
+// pitch EG at a specific rate (0-99).
+func pitchEGSpeed(rate int8) float64 {
+	if rate < 0 {
+		rate = 0
+	}
+	if rate > 99 {
+		rate = 99
+	}
+	return float64(pitchEGRateTable[rate]) / 21.3
+}
+
+// PitchSegments returns the four segments of the EG when it
+// is used as a pitch EG, with levels in octaves.
+// See Segments for the order of the segments.
+func (eg EG) PitchSegments() [4]EGSegment {
+	var (
+		rates  = [4]int8{eg.R1, eg.R2, eg.R3, eg.R4}
+		levels = [5]int8{eg.L4, eg.L1, eg.L2, eg.L3, eg.L4}
+		segs   [4]EGSegment
+	)
+	for i, rate := range rates {
+		segs[i] = EGSegment{
+			From:    PitchEGLevel(levels[i]),
+			To:      PitchEGLevel(levels[i+1]),
+			Time:    PitchEGTime(rate, levels[i], levels[i+1]),
+			Speedup: 1,
+		}
+	}
+	return segs
+}
+
+// Times returns the durations (in seconds) of the four
+// segments of the EG: L4 to L1 at R1, L1 to L2 at R2,
+// L2 to L3 at R3, and L3 to L4 at R4.
+func (eg EG) Times() [4]float64 {
+	return [4]float64{
+		EGTime(eg.R1, eg.L4, eg.L1),
+		EGTime(eg.R2, eg.L1, eg.L2),
+		EGTime(eg.R3, eg.L2, eg.L3),
+		EGTime(eg.R4, eg.L3, eg.L4),
+	}
+}
+
+// Gains returns the linear gains of the four levels of the EG.
+func (eg EG) Gains() [4]float64 {
+	return [4]float64{
+		EGLevelGain(eg.L1),
+		EGLevelGain(eg.L2),
+		EGLevelGain(eg.L3),
+		EGLevelGain(eg.L4),
+	}
+}
+
+// Gain returns the linear gain of the operator's output level.
+func (op *Op) Gain() float64 {
+	return OutputLevelGain(op.OutputLevel)
+}
+
+// ModIndex returns the peak modulation index (in radians) the
+// operator applies to the operators it modulates.
+func (op *Op) ModIndex() float64 {
+	return MaxModIndex * op.Gain()
+}
+
+// Offset returns how much keyboard level scaling changes the
+// output level of an operator for a MIDI note, on the same
+// scale as scaleLevel (0.75 dB per step).
+// Notes are grouped by 3 on either side of the breakpoint, and
+// the offset grows linearly or exponentially with the distance.
+func (kls KbdLevelScaling) Offset(note int) int {
+	offset := note - int(kls.Breakpoint) - breakpointNote
+	if offset >= 0 {
+		return scaleCurve((offset+1)/3, int(kls.Rdepth), kls.Rcurve)
+	}
+	return scaleCurve(-(offset-1)/3, int(kls.Ldepth), kls.Lcurve)
+}
+
+// scaleCurve returns the output level offset of a keyboard level
+// scaling curve for a distance (in groups of 3 notes) from the breakpoint.
+func scaleCurve(group, depth int, curve int8) int {
+	var scale int
+	if curve == curveNegLin || curve == curvePosLin {
+		scale = (group * depth * 329) >> 12
+	} else {
+		if group >= len(expScaleTable) {
+			group = len(expScaleTable) - 1
+		}
+		scale = (expScaleTable[group] * depth * 329) >> 15
+	}
+	if curve == curveNegLin || curve == curveNegExp {
+		return -scale
+	}
+	return scale
+}
+
+// ScaledGain returns the linear gain of the operator's output
+// level with keyboard level scaling applied for a MIDI note.
+// Like Gain it is 1 at full level, and it never exceeds 1.
+func (op *Op) ScaledGain(note int) float64 {
+	if op.OutputLevel <= 0 {
+		return 0
+	}
+	level := scaleLevel(op.OutputLevel) + op.KbdLevelScaling.Offset(note)
+	if level <= 0 {
+		return 0
+	}
+	if level > maxScaledLevel {
+		level = maxScaledLevel
+	}
+	return math.Exp2(float64(level-maxScaledLevel) / 8)
+}
+
+// VelocityGain returns how much a MIDI velocity (0-127) changes
+// the gain of the operator, following its velocity sensitivity.
+// At sensitivity 0 velocity has no effect, and at sensitivity 7
+// soft notes are much quieter while the hardest notes are
+// about 5 dB louder than the output level.
+func (op *Op) VelocityGain(velocity int) float64 {
+	if velocity < 0 {
+		velocity = 0
+	}
+	if velocity > 127 {
+		velocity = 127
+	}
+	var (
+		val   = velocityTable[velocity>>1] - 239
+		delta = ((int(op.KbdVelocitySensitivity)*val + 7) >> 3) << 4
+	)
+	return math.Exp2(float64(delta) / 256)
+}
+
+// RateScaling returns the rate that keyboard rate scaling adds
+// to the operator's EG rates for a MIDI note (see EG.Segments).
+// Higher notes get faster envelopes: at a sensitivity of 7
+// every octave makes the EG about 1.8 times faster.
+func (op *Op) RateScaling(note int) int {
+	x := note/3 - 7
+	if x < 0 {
+		x = 0
+	}
+	if x > 31 {
+		x = 31
+	}
+	return (int(op.KbdRateScaling) * x) >> 3
+}
+
+// Ratio returns the frequency ratio of an oscillator in tracking mode.
+func (osc Oscillator) Ratio() float64 {
+	return coarseRatio(osc.FreqCoarse) * (1 + float64(osc.FreqFine)/100)
+}
+
+// FixedFreq returns the frequency (in Hz) of an oscillator in fixed mode.
+// FreqCoarse selects 1, 10, 100 or 1000 Hz, and FreqFine multiplies
+// that by up to 9.772.
+func (osc Oscillator) FixedFreq() float64 {
+	return math.Pow(10, float64(osc.FreqCoarse&0x03)+float64(osc.FreqFine)/100)
+}
+
+// DetuneCents returns the detune of the oscillator (in cents)
+// when it plays a specific frequency (in Hz).
+// Detune 7 is in tune. The size of a detune step depends on
+// the frequency: it is about 1 cent around A4 and grows for
+// lower notes. In fixed mode the DX7 only detunes upwards.
+func (osc Oscillator) DetuneCents(freq float64) float64 {
+	steps := float64(osc.Detune) - 7
+	if osc.Mode == 1 {
+		if steps < 0 {
+			return 0
+		}
+		return steps * 13457 / (1 << 24) * 1200
+	}
+	if freq <= 0 {
+		return 0
+	}
+	var (
+		octaves = math.Log2(freq)
+		ratio   = 0.0209 * math.Exp(-0.396*octaves) / 7
+	)
+	return steps * ratio * octaves * 1200
+}
+
+// Freq returns the frequency (in Hz) of an oscillator when
+// a note with a specific frequency (in Hz) is played.
+func (osc Oscillator) Freq(note float64) float64 {
+	var freq float64
+	if osc.Mode == 1 {
+		freq = osc.FixedFreq()
+	} else {
+		freq = note * osc.Ratio()
+	}
+	return freq * math.Exp2(osc.DetuneCents(note)/1200)
+}
+
+// rate returns the number of lfoUnits the LFO phase advances per second.
+func (lfo LFO) rate() float64 {
+	sr := 1
+	if lfo.Speed > 0 {
+		sr = (165 * int(lfo.Speed)) >> 6
+	}
+	if sr < 160 {
+		sr *= 11
+	} else {
+		sr *= 11 + ((sr - 160) >> 4)
+	}
+	return float64(sr)
+}
+
+// Freq returns the frequency (in Hz) of the LFO.
+func (lfo LFO) Freq() float64 {
+	return lfoUnit * lfo.rate() / (1 << 32)
+}
+
+// DelayTimes returns the time (in seconds) after a key is
+// pressed before the LFO starts to modulate, and the time it
+// then takes the modulation to fade in to full depth.
+func (lfo LFO) DelayTimes() (onset, ramp float64) {
+	a := 99 - int(lfo.Delay)
+	if a >= 99 {
+		return 0, 0
+	}
+	if a < 0 {
+		a = 0
+	}
+	a = (16 + (a & 15)) << uint(1+(a>>4))
+	a2 := a & 0xFF80
+	if a2 < 0x80 {
+		a2 = 0x80
+	}
+	onset = (1 << 31) / (lfoUnit * float64(a))
+	ramp = (1 << 31) / (lfoUnit * float64(a2))
+	return onset, ramp
+}
+
+// PitchModDepth returns the pitch modulation depth of the LFO
+// in the range [0, 1].
+func (lfo LFO) PitchModDepth() float64 {
+	return clampUnit(float64(lfo.PMD) / 99)
+}
+
+// AmpModDepth returns the amp modulation depth of the LFO
+// in the range [0, 1].
+func (lfo LFO) AmpModDepth() float64 {
+	return clampUnit(float64(lfo.AMD) / 99)
+}
+
+// PitchModRange returns the pitch deviation (in octaves) that the
+// LFO causes at full depth for a pitch mod sensitivity (0-7).
+func PitchModRange(sensitivity int8) float64 {
+	if sensitivity < 0 {
+		return 0
+	}
+	if sensitivity > 7 {
+		sensitivity = 7
+	}
+	return maxPitchMod * pitchModSensTable[sensitivity] / 255
+}
+
+// AmpModRange returns the attenuation (in dB) that the LFO
+// causes at full depth for an amp mod sensitivity (0-3).
+// At the highest sensitivity the LFO sweeps an operator
+// across the whole range of its EG.
+func AmpModRange(sensitivity int8) float64 {
+	if sensitivity < 0 {
+		return 0
+	}
+	if sensitivity > 3 {
+		sensitivity = 3
+	}
+	return -EGLevelDB(0) * ampModSensTable[sensitivity] / 255
+}
+
+// clampUnit clamps a value to the range [0, 1].
+func clampUnit(val float64) float64 {
+	return math.Max(0, math.Min(1, val))
+}
+
+// FeedbackIndex converts a feedback level (0-7) to the
+// modulation index (in radians) that an operator applies to
+// itself. Every step doubles the amount of feedback, and 7 is π.
+func FeedbackIndex(feedback int8) float64 {
+	if feedback <= 0 {
+		return 0
+	}
+	if feedback > 7 {
+		feedback = 7
+	}
+	return math.Pi * math.Exp2(float64(feedback-7))
+}
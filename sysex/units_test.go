@@ -0,0 +1,347 @@
+package sysex
+
+import (
+	"math"
+	"testing"
+)
+
+// closeTo reports whether two floats are within a relative tolerance.
+func closeTo(expected, got, tolerance float64) bool {
+	return math.Abs(expected-got) <= tolerance*math.Abs(expected)
+}
+
+func TestOutputLevelGain(t *testing.T) {
+	for _, tc := range []struct {
+		Level int8
+		Gain  float64
+	}{
+		{99, 1},
+		{91, math.Exp2(-1)},
+		{83, math.Exp2(-2)},
+		{20, math.Exp2(-79.0 / 8)},
+		{0, 0},
+	} {
+		if expected, got := tc.Gain, OutputLevelGain(tc.Level); !closeTo(expected, got, 1e-9) {
+			t.Fatalf("level %d: expected %f got %f", tc.Level, expected, got)
+		}
+	}
+}
+
+func TestEGLevelGain(t *testing.T) {
+	if expected, got := 1.0, EGLevelGain(99); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if expected, got := 0.0, EGLevelGain(0); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	for level := int8(1); level < 99; level++ {
+		if EGLevelGain(level) > EGLevelGain(level+1) {
+			t.Fatalf("EG gain decreases from level %d to %d", level, level+1)
+		}
+	}
+}
+
+func TestEGTime(t *testing.T) {
+	// Decays are linear in dB, so half the distance takes half the time.
+	full, half := EGTime(50, 99, 0), EGTime(50, 99, 50)
+	if full <= half {
+		t.Fatalf("Expected full decay (%f) to be longer than partial decay (%f)", full, half)
+	}
+	if expected, got := 0.0, EGTime(50, 70, 70); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	// Attacks are faster than decays over the same distance.
+	if attack, decay := EGTime(50, 0, 99), EGTime(50, 99, 0); attack >= decay {
+		t.Fatalf("Expected attack (%f) to be faster than decay (%f)", attack, decay)
+	}
+	for rate := int8(0); rate < 99; rate++ {
+		if EGTime(rate, 99, 0) < EGTime(rate+1, 99, 0) {
+			t.Fatalf("decay time increases from rate %d to %d", rate, rate+1)
+		}
+	}
+	if got := EGTime(99, 99, 0); got > 0.01 {
+		t.Fatalf("Expected a decay at rate 99 to be shorter than 10ms, got %f", got)
+	}
+	if got := EGTime(0, 99, 0); got < 60 {
+		t.Fatalf("Expected a decay at rate 0 to be longer than a minute, got %f", got)
+	}
+}
+
+func TestEGSegments(t *testing.T) {
+	eg := EG{R1: 80, R2: 50, R3: 30, R4: 60, L1: 99, L2: 80, L3: 70, L4: 0}
+	segs := eg.Segments(0)
+
+	// The attack jumps to about -50 dB and slows down as it rises.
+	if got := segs[0].From; got < -55 || got > -45 {
+		t.Fatalf("Expected attack to start around -50 dB, got %f", got)
+	}
+	if expected, got := 0.0, segs[0].To; expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if got := segs[0].Speedup; got <= 1 {
+		t.Fatalf("Expected attack to slow down, got speedup %f", got)
+	}
+	for i, seg := range segs[1:] {
+		if expected, got := segs[i].To, seg.From; expected != got {
+			t.Fatalf("segment %d: expected to start at %f, got %f", i+2, expected, got)
+		}
+		if expected, got := 1.0, seg.Speedup; expected != got {
+			t.Fatalf("segment %d: expected speedup %f, got %f", i+2, expected, got)
+		}
+	}
+	times := eg.Times()
+	for i, time := range times[:3] {
+		if expected, got := time, segs[i].Time; expected != got {
+			t.Fatalf("segment %d: expected time %f, got %f", i+1, expected, got)
+		}
+	}
+	// The release lasts as long as R4 takes from the highest level.
+	if expected, got := EGTime(eg.R4, eg.L1, eg.L4), segs[3].Time; expected != got {
+		t.Fatalf("Expected release time %f got %f", expected, got)
+	}
+	if expected, got := EGLevelDB(0), segs[3].To; expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	// An EG whose L3 equals L4 can still be released from L1 or L2.
+	held := EG{R1: 99, R2: 40, R3: 30, R4: 50, L1: 99, L2: 60, L3: 0, L4: 0}.Segments(0)[3]
+	if held.Time <= 0 {
+		t.Fatalf("Expected a release when L3 equals L4, got %+v", held)
+	}
+	// A rise that stays below the jump level is immediate.
+	low := EG{R1: 50, L1: 20, L4: 0}.Segments(0)[0]
+	if low.From != low.To || low.Time != 0 {
+		t.Fatalf("Expected an immediate rise, got %+v", low)
+	}
+}
+
+func TestPitchEG(t *testing.T) {
+	for _, tc := range []struct {
+		Level  int8
+		Octave float64
+	}{
+		{0, -4},
+		{50, 0},
+		{51, 1.0 / 32},
+		{99, 127.0 / 32},
+	} {
+		if expected, got := tc.Octave, PitchEGLevel(tc.Level); expected != got {
+			t.Fatalf("level %d: expected %f got %f", tc.Level, expected, got)
+		}
+	}
+	for level := int8(0); level < 99; level++ {
+		if PitchEGLevel(level) >= PitchEGLevel(level+1) {
+			t.Fatalf("pitch does not rise from level %d to %d", level, level+1)
+		}
+	}
+	for rate := int8(0); rate < 99; rate++ {
+		if PitchEGTime(rate, 0, 99) < PitchEGTime(rate+1, 0, 99) {
+			t.Fatalf("pitch EG time increases from rate %d to %d", rate, rate+1)
+		}
+	}
+	for _, tc := range []struct {
+		Rate  int8
+		Speed float64
+	}{
+		{0, 1},
+		{20, 12},
+		{50, 41},
+		{77, 102},
+		{90, 171},
+		{96, 232},
+		{99, 255},
+	} {
+		if expected, got := tc.Speed/21.3, pitchEGSpeed(tc.Rate); expected != got {
+			t.Fatalf("rate %d: expected %f octaves per second, got %f", tc.Rate, expected, got)
+		}
+	}
+	// The pitch EG moves at a constant speed in both directions.
+	if expected, got := PitchEGTime(50, 50, 99), PitchEGTime(50, 99, 50); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	eg := EG{R1: 99, R2: 50, R3: 50, R4: 50, L1: 99, L2: 50, L3: 50, L4: 50}
+	segs := eg.PitchSegments()
+	if expected, got := 0.0, segs[0].From; expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if expected, got := PitchEGLevel(99), segs[0].To; expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if expected, got := PitchEGTime(50, 99, 50), segs[1].Time; expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+}
+
+func TestKbdLevelScaling(t *testing.T) {
+	// Breakpoint 39 is C3 (MIDI note 60).
+	kls := KbdLevelScaling{Breakpoint: 39, Ldepth: 99, Rdepth: 99, Lcurve: curveNegLin, Rcurve: curvePosExp}
+
+	for _, tc := range []struct {
+		Note   int
+		Offset int
+	}{
+		{60, 0},
+		{59, 0},
+		{57, -7},
+		{48, -31},
+		{72, 3},
+		{96, 15},
+		{108, 32},
+	} {
+		if expected, got := tc.Offset, kls.Offset(tc.Note); expected != got {
+			t.Fatalf("note %d: expected offset %d, got %d", tc.Note, expected, got)
+		}
+	}
+	op := Op{OutputLevel: 91, KbdLevelScaling: kls}
+
+	if expected, got := op.Gain(), op.ScaledGain(60); !closeTo(expected, got, 1e-9) {
+		t.Fatalf("expected gain %f at the breakpoint, got %f", expected, got)
+	}
+	if expected, got := 1.0, op.ScaledGain(108); expected != got {
+		t.Fatalf("expected gain to be capped at %f, got %f", expected, got)
+	}
+	if expected, got := 0.0, op.ScaledGain(0); expected != got {
+		t.Fatalf("expected silence far below the breakpoint, got %f", got)
+	}
+}
+
+func TestRateScaling(t *testing.T) {
+	op := Op{KbdRateScaling: 7}
+
+	if expected, got := 0, op.RateScaling(21); expected != got {
+		t.Fatalf("expected rate scaling %d, got %d", expected, got)
+	}
+	if expected, got := 11, op.RateScaling(60); expected != got {
+		t.Fatalf("expected rate scaling %d, got %d", expected, got)
+	}
+	if expected, got := 27, op.RateScaling(127); expected != got {
+		t.Fatalf("expected rate scaling %d, got %d", expected, got)
+	}
+	eg := EG{R1: 50, R2: 50, R3: 50, R4: 50, L1: 99, L2: 50, L3: 50, L4: 0}
+	if slow, fast := eg.Segments(0)[1].Time, eg.Segments(op.RateScaling(96))[1].Time; fast >= slow {
+		t.Fatalf("expected rate scaling to shorten the decay, got %f >= %f", fast, slow)
+	}
+}
+
+func TestVelocityGain(t *testing.T) {
+	if expected, got := 1.0, (&Op{}).VelocityGain(1); expected != got {
+		t.Fatalf("expected gain %f without velocity sensitivity, got %f", expected, got)
+	}
+	op := &Op{KbdVelocitySensitivity: 7}
+
+	if expected, got := math.Exp2(224.0/256), op.VelocityGain(127); !closeTo(expected, got, 1e-9) {
+		t.Fatalf("expected gain %f at full velocity, got %f", expected, got)
+	}
+	if expected, got := 1.0, op.VelocityGain(98); expected != got {
+		t.Fatalf("expected gain %f at velocity 98, got %f", expected, got)
+	}
+	if got := op.VelocityGain(1); got > 0.01 {
+		t.Fatalf("expected soft notes to be quieter, got gain %f", got)
+	}
+	for v := 1; v <= 127; v++ {
+		if op.VelocityGain(v) < op.VelocityGain(v-1) {
+			t.Fatalf("expected gain to grow with velocity at %d", v)
+		}
+	}
+}
+
+func TestOscillatorFreq(t *testing.T) {
+	for _, tc := range []struct {
+		Osc  Oscillator
+		Note float64
+		Freq float64
+	}{
+		{Oscillator{FreqCoarse: 0, Detune: 7}, 440, 220},
+		{Oscillator{FreqCoarse: 1, Detune: 7}, 440, 440},
+		{Oscillator{FreqCoarse: 2, FreqFine: 50, Detune: 7}, 100, 300},
+		{Oscillator{Mode: 1, FreqCoarse: 0, Detune: 7}, 440, 1},
+		{Oscillator{Mode: 1, FreqCoarse: 2, Detune: 7}, 440, 100},
+		{Oscillator{Mode: 1, FreqCoarse: 3, FreqFine: 99}, 440, 9772.372},
+	} {
+		if expected, got := tc.Freq, tc.Osc.Freq(tc.Note); !closeTo(expected, got, 1e-6) {
+			t.Fatalf("%#v: expected %f got %f", tc.Osc, expected, got)
+		}
+	}
+}
+
+func TestDetuneCents(t *testing.T) {
+	var (
+		up   = Oscillator{Detune: 14}
+		down = Oscillator{Detune: 0}
+	)
+	if cents := up.DetuneCents(440); cents < 5 || cents > 10 {
+		t.Fatalf("Expected about 7 cents at A4, got %f", cents)
+	}
+	if expected, got := -up.DetuneCents(440), down.DetuneCents(440); !closeTo(expected, got, 1e-9) {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if up.DetuneCents(55) <= up.DetuneCents(440) {
+		t.Fatal("Expected detune steps to be larger for lower notes")
+	}
+	if expected, got := 0.0, (Oscillator{Mode: 1, Detune: 0}).DetuneCents(440); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+}
+
+func TestLFO(t *testing.T) {
+	if got := (LFO{Speed: 0}).Freq(); !closeTo(0.0645, got, 0.01) {
+		t.Fatalf("Expected slowest LFO to be about 0.0645Hz, got %f", got)
+	}
+	for speed := int8(0); speed < 99; speed++ {
+		if (LFO{Speed: speed}).Freq() > (LFO{Speed: speed + 1}).Freq() {
+			t.Fatalf("LFO frequency decreases from speed %d to %d", speed, speed+1)
+		}
+	}
+	if onset, ramp := (LFO{Delay: 0}).DelayTimes(); onset != 0 || ramp != 0 {
+		t.Fatalf("Expected no delay, got %f and %f", onset, ramp)
+	}
+	short, _ := (LFO{Delay: 20}).DelayTimes()
+	long, _ := (LFO{Delay: 80}).DelayTimes()
+	if short >= long {
+		t.Fatalf("Expected delay 20 (%f) to be shorter than delay 80 (%f)", short, long)
+	}
+}
+
+func TestModRanges(t *testing.T) {
+	if expected, got := 0.0, PitchModRange(0); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if expected, got := float64(maxPitchMod), PitchModRange(7); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	for pms := int8(0); pms < 7; pms++ {
+		if PitchModRange(pms) >= PitchModRange(pms+1) {
+			t.Fatalf("pitch mod range does not grow from sensitivity %d to %d", pms, pms+1)
+		}
+	}
+	if expected, got := 0.0, AmpModRange(0); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if expected, got := -EGLevelDB(0), AmpModRange(3); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	lfo := LFO{PMD: 99, AMD: 0}
+	if expected, got := 1.0, lfo.PitchModDepth(); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if expected, got := 0.0, lfo.AmpModDepth(); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+}
+
+func TestFeedbackIndex(t *testing.T) {
+	if expected, got := math.Pi, FeedbackIndex(7); !closeTo(expected, got, 1e-9) {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if expected, got := math.Pi/2, FeedbackIndex(6); !closeTo(expected, got, 1e-9) {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+	if expected, got := 0.0, FeedbackIndex(0); expected != got {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+}
+
+func TestMaxModIndex(t *testing.T) {
+	if expected, got := 4*math.Pi, MaxModIndex; !closeTo(expected, got, 1e-9) {
+		t.Fatalf("Expected %f got %f", expected, got)
+	}
+}
@@ -0,0 +1,224 @@
+package sysex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Legal range of the characters in a voice name.
+const (
+	minNameChar = 0x20
+	maxNameChar = 0x7F
+)
+
+// RangeError describes a voice parameter whose value is
+// outside of the range the DX7 accepts.
+type RangeError struct {
+	// Path locates the parameter using the same names as the
+	// json encoding of a voice, e.g. ops[3].amp.r2
+	Path  string
+	Value int
+	Min   int
+	Max   int
+}
+
+// Error implements the error interface.
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%s: %d is out of range [%d, %d]", e.Path, e.Value, e.Min, e.Max)
+}
+
+// RangeErrors is a list of out of range parameters.
+type RangeErrors []*RangeError
+
+// Error implements the error interface.
+func (errs RangeErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// paramFunc is called with a parameter, its path and the
+// range of values the DX7 accepts for it.
+type paramFunc func(path string, val *int8, min, max int8)
+
+// Validate checks that every parameter of the voice is within
+// the range the DX7 accepts.
+// If any are not the returned error is a RangeErrors that
+// lists all of them.
+func (bd *BulkDump) Validate() error {
+	var errs RangeErrors
+
+	bd.params(func(path string, val *int8, min, max int8) {
+		if *val < min || *val > max {
+			errs = append(errs, &RangeError{Path: path, Value: int(*val), Min: int(min), Max: int(max)})
+		}
+	})
+	if n := bd.numOps(); n != numOps || len(bd.Ops) != numOps {
+		errs = append(errs, &RangeError{Path: "ops", Value: n, Min: numOps, Max: numOps})
+	}
+	if n := len(bd.Name); n != nameLength {
+		errs = append(errs, &RangeError{Path: "name", Value: n, Min: nameLength, Max: nameLength})
+	}
+	for i, c := range []byte(bd.Name) {
+		if c < minNameChar || c > maxNameChar {
+			errs = append(errs, &RangeError{Path: fmt.Sprintf("name[%d]", i), Value: int(c), Min: minNameChar, Max: maxNameChar})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Clamp repairs a voice so that it passes Validate.
+// Out of range parameters are set to the nearest legal value,
+// missing operators are added, extra operators are dropped,
+// the name is padded with spaces or truncated to 10 characters,
+// and illegal characters in it are replaced by spaces.
+// Stray bits that a packed voice had outside of its
+// parameters are also cleared.
+func (bd *BulkDump) Clamp() {
+	ops := make([]*Op, numOps)
+	for i := range ops {
+		if i < len(bd.Ops) && bd.Ops[i] != nil {
+			ops[i] = bd.Ops[i]
+		} else {
+			ops[i] = &Op{}
+		}
+	}
+	bd.Ops = ops
+
+	bd.params(func(path string, val *int8, min, max int8) {
+		if *val < min {
+			*val = min
+		}
+		if *val > max {
+			*val = max
+		}
+	})
+	name := paddedName(bd.Name)
+	for i, c := range name {
+		if c < minNameChar || c > maxNameChar {
+			name[i] = ' '
+		}
+	}
+	bd.Name = string(name)
+	bd.unused = [voiceDataLength]byte{}
+}
+
+// Validate checks every voice in the bank.
+// The paths of the returned RangeErrors start with the
+// index of the voice, e.g. [12].ops[3].amp.r2
+func (bank *Bank) Validate() error {
+	var errs RangeErrors
+
+	for i, voice := range bank {
+		if voice == nil {
+			errs = append(errs, &RangeError{Path: fmt.Sprintf("[%d].ops", i), Value: 0, Min: numOps, Max: numOps})
+			continue
+		}
+		verrs, ok := voice.Validate().(RangeErrors)
+		if !ok {
+			continue
+		}
+		for _, err := range verrs {
+			err.Path = fmt.Sprintf("[%d].%s", i, err.Path)
+		}
+		errs = append(errs, verrs...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Clamp repairs every voice in the bank.
+// Empty slots are filled with a voice whose parameters are all zero.
+func (bank *Bank) Clamp() {
+	for i, voice := range bank {
+		if voice == nil {
+			voice = &BulkDump{Name: string(paddedName(""))}
+			bank[i] = voice
+		}
+		voice.Clamp()
+	}
+}
+
+// numOps counts the operators of the voice.
+func (bd *BulkDump) numOps() int {
+	n := 0
+	for _, op := range bd.Ops {
+		if op != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// params calls f for every numeric parameter of the voice.
+func (bd *BulkDump) params(f paramFunc) {
+	for i, op := range bd.Ops {
+		if op != nil {
+			op.params(fmt.Sprintf("ops[%d].", i), f)
+		}
+	}
+	bd.PitchEG.params("pitch_eg.", f)
+	f("algorithm", &bd.Algorithm, 0, 31)
+	f("osc_key_sync", &bd.OscKeySync, 0, 1)
+	f("feedback", &bd.Feedback, 0, 7)
+	bd.LFO.params("lfo.", f)
+	f("transpose", &bd.Transpose, 0, 48)
+}
+
+// params calls f for every parameter of the op.
+func (op *Op) params(prefix string, f paramFunc) {
+	op.AmpEG.params(prefix+"amp.", f)
+	op.KbdLevelScaling.params(prefix+"kbd_level_scaling.", f)
+	f(prefix+"kbd_rate_scaling", &op.KbdRateScaling, 0, 7)
+	f(prefix+"output_level", &op.OutputLevel, 0, 99)
+	f(prefix+"kbd_velocity_sensitivity", &op.KbdVelocitySensitivity, 0, 7)
+	f(prefix+"amp_mod_sensitivity", &op.AmpModSensitivity, 0, 3)
+	op.Oscillator.params(prefix+"oscillator.", f)
+}
+
+// params calls f for every parameter of the oscillator.
+func (osc *Oscillator) params(prefix string, f paramFunc) {
+	f(prefix+"mode", &osc.Mode, 0, 1)
+	f(prefix+"freq_coarse", &osc.FreqCoarse, 0, 31)
+	f(prefix+"freq_fine", &osc.FreqFine, 0, 99)
+	f(prefix+"detune", &osc.Detune, 0, 14)
+}
+
+// params calls f for every keyboard level scaling parameter.
+func (kls *KbdLevelScaling) params(prefix string, f paramFunc) {
+	f(prefix+"breakpoint", &kls.Breakpoint, 0, 99)
+	f(prefix+"ldepth", &kls.Ldepth, 0, 99)
+	f(prefix+"rdepth", &kls.Rdepth, 0, 99)
+	f(prefix+"lcurve", &kls.Lcurve, 0, 3)
+	f(prefix+"rcurve", &kls.Rcurve, 0, 3)
+}
+
+// params calls f for every rate and level of the EG.
+func (eg *EG) params(prefix string, f paramFunc) {
+	f(prefix+"r1", &eg.R1, 0, 99)
+	f(prefix+"r2", &eg.R2, 0, 99)
+	f(prefix+"r3", &eg.R3, 0, 99)
+	f(prefix+"r4", &eg.R4, 0, 99)
+	f(prefix+"l1", &eg.L1, 0, 99)
+	f(prefix+"l2", &eg.L2, 0, 99)
+	f(prefix+"l3", &eg.L3, 0, 99)
+	f(prefix+"l4", &eg.L4, 0, 99)
+}
+
+// params calls f for every parameter of the LFO.
+func (lfo *LFO) params(prefix string, f paramFunc) {
+	f(prefix+"speed", &lfo.Speed, 0, 99)
+	f(prefix+"delay", &lfo.Delay, 0, 99)
+	f(prefix+"pmd", &lfo.PMD, 0, 99)
+	f(prefix+"amd", &lfo.AMD, 0, 99)
+	f(prefix+"pm_sensitivity", &lfo.PMSensitivity, 0, 7)
+	f(prefix+"wave", &lfo.Wave, 0, 5)
+	f(prefix+"sync", &lfo.Sync, 0, 1)
+}
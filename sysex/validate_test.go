@@ -0,0 +1,131 @@
+package sysex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateFactoryBank(t *testing.T) {
+	f, err := os.Open(filepath.Join("..", "assets", "syx", "rom1a.syx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	syx, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syx.Data.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	voice := &BulkDump{
+		Ops:       []*Op{{}, {}, {}, {}, {}, {}},
+		Algorithm: 32,
+		Transpose: -1,
+		Name:      "BAD\x01VOICE ",
+	}
+	voice.Ops[3].AmpEG.R2 = 100
+	voice.Ops[0].Oscillator.Detune = 15
+	voice.LFO.Wave = 6
+
+	errs, ok := voice.Validate().(RangeErrors)
+	if !ok {
+		t.Fatal("Expected RangeErrors")
+	}
+	expected := []RangeError{
+		{Path: "ops[0].oscillator.detune", Value: 15, Min: 0, Max: 14},
+		{Path: "ops[3].amp.r2", Value: 100, Min: 0, Max: 99},
+		{Path: "algorithm", Value: 32, Min: 0, Max: 31},
+		{Path: "lfo.wave", Value: 6, Min: 0, Max: 5},
+		{Path: "transpose", Value: -1, Min: 0, Max: 48},
+		{Path: "name[3]", Value: 1, Min: minNameChar, Max: maxNameChar},
+	}
+	if len(expected) != len(errs) {
+		t.Fatalf("Expected %d errors got %d: %s", len(expected), len(errs), errs)
+	}
+	for i, err := range errs {
+		if expected[i] != *err {
+			t.Fatalf("Expected %#v got %#v", expected[i], *err)
+		}
+	}
+
+	voice.Clamp()
+	if err := voice.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := int8(99), voice.Ops[3].AmpEG.R2; expected != got {
+		t.Fatalf("Expected %d got %d", expected, got)
+	}
+	if expected, got := int8(0), voice.Transpose; expected != got {
+		t.Fatalf("Expected %d got %d", expected, got)
+	}
+	if expected, got := "BAD VOICE ", voice.Name; expected != got {
+		t.Fatalf("Expected %q got %q", expected, got)
+	}
+}
+
+func TestValidateOps(t *testing.T) {
+	voice := &BulkDump{Ops: []*Op{{}, nil, {}}, Name: "MISSING   "}
+
+	errs, ok := voice.Validate().(RangeErrors)
+	if !ok {
+		t.Fatal("Expected RangeErrors")
+	}
+	if expected, got := (RangeError{Path: "ops", Value: 2, Min: numOps, Max: numOps}), *errs[0]; expected != got {
+		t.Fatalf("Expected %#v got %#v", expected, got)
+	}
+	voice.Clamp()
+	if err := voice.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		clamped string
+	}{
+		{name: "SHORT", clamped: "SHORT     "},
+		{name: "MUCH TOO LONG", clamped: "MUCH TOO L"},
+		{name: "", clamped: "          "},
+	} {
+		voice := &BulkDump{Ops: []*Op{{}, {}, {}, {}, {}, {}}, Name: tc.name}
+
+		errs, ok := voice.Validate().(RangeErrors)
+		if !ok {
+			t.Fatalf("%q: Expected RangeErrors", tc.name)
+		}
+		if expected, got := (RangeError{Path: "name", Value: len(tc.name), Min: nameLength, Max: nameLength}), *errs[0]; expected != got {
+			t.Fatalf("%q: Expected %#v got %#v", tc.name, expected, got)
+		}
+		voice.Clamp()
+		if err := voice.Validate(); err != nil {
+			t.Fatalf("%q: %s", tc.name, err)
+		}
+		if expected, got := tc.clamped, voice.Name; expected != got {
+			t.Fatalf("Expected %q got %q", expected, got)
+		}
+	}
+}
+
+func TestBankValidate(t *testing.T) {
+	bank := &Bank{}
+	bank.Clamp()
+	if err := bank.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	bank[12].Ops[3].AmpEG.R2 = 120
+
+	errs, ok := bank.Validate().(RangeErrors)
+	if !ok {
+		t.Fatal("Expected RangeErrors")
+	}
+	if expected, got := "[12].ops[3].amp.r2", errs[0].Path; expected != got {
+		t.Fatalf("Expected %s got %s", expected, got)
+	}
+}
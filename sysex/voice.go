@@ -0,0 +1,141 @@
+package sysex
+
+import "fmt"
+
+const (
+	singleVoiceLength   = 155
+	unpackedOpLength    = 21
+	unpackedVoiceOffset = unpackedOpLength * numOps
+)
+
+// Common errors.
+var (
+	ErrInvalidSingleVoiceLength = fmt.Errorf("single voice dump must be %d bytes in length", singleVoiceLength)
+)
+
+// NewVoice creates a new BulkDump from the data bytes of a
+// single voice dump (format 0).
+// Unlike the packed voices of a 32-voice bulk dump, every
+// parameter of a single voice dump has a byte of its own.
+func NewVoice(data []byte) (*BulkDump, error) {
+	if len(data) != singleVoiceLength {
+		return nil, ErrInvalidSingleVoiceLength
+	}
+	ops := make([]*Op, numOps)
+	for i, j := numOps, 0; i > 0; i-- {
+		op, err := newUnpackedOp(data[j*unpackedOpLength : (j*unpackedOpLength)+unpackedOpLength])
+		if err != nil {
+			return nil, err
+		}
+		ops[i-1] = op
+		j++
+	}
+
+	offset := unpackedVoiceOffset
+
+	pitchEG, err := NewEG(data[offset : offset+egDataLength])
+	if err != nil {
+		return nil, err
+	}
+	return &BulkDump{
+		Ops:        ops,
+		PitchEG:    pitchEG,
+		Algorithm:  int8(data[offset+8]),
+		Feedback:   int8(data[offset+9]),
+		OscKeySync: int8(data[offset+10]),
+		LFO: LFO{
+			Speed:         int8(data[offset+11]),
+			Delay:         int8(data[offset+12]),
+			PMD:           int8(data[offset+13]),
+			AMD:           int8(data[offset+14]),
+			Sync:          int8(data[offset+15]),
+			Wave:          int8(data[offset+16]),
+			PMSensitivity: int8(data[offset+17]),
+		},
+		Transpose: int8(data[offset+18]),
+		Name:      string(data[offset+19 : offset+19+nameLength]),
+	}, nil
+}
+
+// Unpacked encodes the voice in the 155-byte format
+// used by single voice dumps.
+func (bd *BulkDump) Unpacked() []byte {
+	data := make([]byte, singleVoiceLength)
+	for i, j := numOps, 0; i > 0; i-- {
+		if i <= len(bd.Ops) && bd.Ops[i-1] != nil {
+			copy(data[j*unpackedOpLength:], bd.Ops[i-1].unpacked())
+		}
+		j++
+	}
+
+	offset := unpackedVoiceOffset
+
+	copy(data[offset:], bd.PitchEG.bytes())
+	data[offset+8] = byte(bd.Algorithm)
+	data[offset+9] = byte(bd.Feedback)
+	data[offset+10] = byte(bd.OscKeySync)
+	data[offset+11] = byte(bd.LFO.Speed)
+	data[offset+12] = byte(bd.LFO.Delay)
+	data[offset+13] = byte(bd.LFO.PMD)
+	data[offset+14] = byte(bd.LFO.AMD)
+	data[offset+15] = byte(bd.LFO.Sync)
+	data[offset+16] = byte(bd.LFO.Wave)
+	data[offset+17] = byte(bd.LFO.PMSensitivity)
+	data[offset+18] = byte(bd.Transpose)
+	copy(data[offset+19:], paddedName(bd.Name))
+
+	return data
+}
+
+// newUnpackedOp creates a new Op from the 21 bytes that
+// describe an operator in a single voice dump.
+func newUnpackedOp(data []byte) (*Op, error) {
+	if err := checkLength(data, unpackedOpLength); err != nil {
+		return nil, err
+	}
+	ampEG, err := NewEG(data[0:egDataLength])
+	if err != nil {
+		return nil, err
+	}
+	return &Op{
+		AmpEG: ampEG,
+		KbdLevelScaling: KbdLevelScaling{
+			Breakpoint: int8(data[8]),
+			Ldepth:     int8(data[9]),
+			Rdepth:     int8(data[10]),
+			Lcurve:     int8(data[11]),
+			Rcurve:     int8(data[12]),
+		},
+		KbdRateScaling:         int8(data[13]),
+		AmpModSensitivity:      int8(data[14]),
+		KbdVelocitySensitivity: int8(data[15]),
+		OutputLevel:            int8(data[16]),
+		Oscillator: Oscillator{
+			Mode:       int8(data[17]),
+			FreqCoarse: int8(data[18]),
+			FreqFine:   int8(data[19]),
+			Detune:     int8(data[20]),
+		},
+	}, nil
+}
+
+// unpacked encodes the op in the 21-byte format used by
+// single voice dumps.
+func (op *Op) unpacked() []byte {
+	data := make([]byte, unpackedOpLength)
+	copy(data[0:egDataLength], op.AmpEG.bytes())
+	data[8] = byte(op.KbdLevelScaling.Breakpoint)
+	data[9] = byte(op.KbdLevelScaling.Ldepth)
+	data[10] = byte(op.KbdLevelScaling.Rdepth)
+	data[11] = byte(op.KbdLevelScaling.Lcurve)
+	data[12] = byte(op.KbdLevelScaling.Rcurve)
+	data[13] = byte(op.KbdRateScaling)
+	data[14] = byte(op.AmpModSensitivity)
+	data[15] = byte(op.KbdVelocitySensitivity)
+	data[16] = byte(op.OutputLevel)
+	data[17] = byte(op.Oscillator.Mode)
+	data[18] = byte(op.Oscillator.FreqCoarse)
+	data[19] = byte(op.Oscillator.FreqFine)
+	data[20] = byte(op.Oscillator.Detune)
+	return data
+}
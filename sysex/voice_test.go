@@ -0,0 +1,58 @@
+package sysex
+
+import "testing"
+
+func TestNewVoice(t *testing.T) {
+	data := make([]byte, singleVoiceLength)
+	for i := range data {
+		data[i] = byte(i % 100)
+	}
+	copy(data[145:], "E.PIANO 1 ")
+
+	voice, err := NewVoice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := numOps, len(voice.Ops); expected != got {
+		t.Fatalf("Expected %d ops got %d", expected, got)
+	}
+	for _, tc := range []struct {
+		Name     string
+		Expected int8
+		Got      int8
+	}{
+		{"op6 r1", 0, voice.Ops[5].AmpEG.R1},
+		{"op6 l4", 7, voice.Ops[5].AmpEG.L4},
+		{"op6 rcurve", 12, voice.Ops[5].KbdLevelScaling.Rcurve},
+		{"op6 detune", 20, voice.Ops[5].Oscillator.Detune},
+		{"op5 breakpoint", 29, voice.Ops[4].KbdLevelScaling.Breakpoint},
+		{"op1 ams", 19, voice.Ops[0].AmpModSensitivity},
+		{"op1 kvs", 20, voice.Ops[0].KbdVelocitySensitivity},
+		{"op1 output level", 21, voice.Ops[0].OutputLevel},
+		{"op1 mode", 22, voice.Ops[0].Oscillator.Mode},
+		{"op1 freq coarse", 23, voice.Ops[0].Oscillator.FreqCoarse},
+		{"pitch eg r1", 26, voice.PitchEG.R1},
+		{"pitch eg l4", 33, voice.PitchEG.L4},
+		{"algorithm", 34, voice.Algorithm},
+		{"feedback", 35, voice.Feedback},
+		{"osc key sync", 36, voice.OscKeySync},
+		{"lfo speed", 37, voice.LFO.Speed},
+		{"lfo sync", 41, voice.LFO.Sync},
+		{"lfo wave", 42, voice.LFO.Wave},
+		{"lfo pm sensitivity", 43, voice.LFO.PMSensitivity},
+		{"transpose", 44, voice.Transpose},
+	} {
+		if tc.Expected != tc.Got {
+			t.Fatalf("%s: expected %d got %d", tc.Name, tc.Expected, tc.Got)
+		}
+	}
+	if expected, got := "E.PIANO 1 ", voice.Name; expected != got {
+		t.Fatalf("Expected %q got %q", expected, got)
+	}
+}
+
+func TestNewVoiceInvalidLength(t *testing.T) {
+	if _, err := NewVoice(make([]byte, voiceDataLength)); err != ErrInvalidSingleVoiceLength {
+		t.Fatalf("Expected ErrInvalidSingleVoiceLength got %v", err)
+	}
+}
@@ -15,14 +15,32 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "Usage:\n")
 	fmt.Fprintf(os.Stderr, "  %s [OPTIONS] [FILE]\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "If FILE is not provided, sysex data will be read from stdin.\n")
+	fmt.Fprintf(os.Stderr, "Every DX7 voice dump in the input is converted.\n")
 	fmt.Fprintf(os.Stderr, "OPTIONS\n")
 	fmt.Fprintf(os.Stderr, "  -format          xml|json\n")
+	fmt.Fprintf(os.Stderr, "  -lenient         load damaged sysex data with a warning\n")
+	fmt.Fprintf(os.Stderr, "  -reverse         convert xml or json (see -format) back to sysex data\n")
 }
 
 func main() {
-	format := flag.String("format", "xml", "output format")
+	var (
+		format  = flag.String("format", "xml", "output format")
+		lenient = flag.Bool("lenient", false, "tolerate bad checksums")
+		reverse = flag.Bool("reverse", false, "convert xml or json to sysex")
+	)
 	flag.Parse()
 
+	opts := sysex.Options{Lenient: *lenient}
+
+	convert := func(r io.Reader, w io.Writer) error {
+		return run(r, w, *format, opts)
+	}
+	if *reverse {
+		convert = func(r io.Reader, w io.Writer) error {
+			return runReverse(r, w, *format)
+		}
+	}
+
 	if *format != "xml" && *format != "json" {
 		usage()
 		os.Exit(1)
@@ -31,18 +49,21 @@ func main() {
 	args := flag.Args()
 	switch len(args) {
 	case 0:
-		// Read sysex data from stdin.
-		if err := run(os.Stdin, os.Stdout, *format); err != nil {
+		// Read data from stdin.
+		if err := convert(os.Stdin, os.Stdout); err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
 	case 1:
-		// Read sysex data from a file.
+		// Read data from a file.
 		r, err := os.Open(args[0])
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-		if err := run(r, os.Stdout, *format); err != nil {
+		if err := convert(r, os.Stdout); err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
 	default:
 		usage()
@@ -51,18 +72,81 @@ func main() {
 }
 
 // run is the heart of the program.
-func run(r io.Reader, w io.Writer, format string) error {
-	syx, err := sysex.New(r)
-	if err != nil {
-		return err
+// Every DX7 sysex message in r is written to w.
+func run(r io.Reader, w io.Writer, format string, opts sysex.Options) error {
+	var enc interface {
+		Encode(v interface{}) error
+	}
+	switch format {
+	default:
+		return fmt.Errorf("Unrecognized format: %s", format)
+	case "xml":
+		enc = xml.NewEncoder(w)
+	case "json":
+		enc = json.NewEncoder(w)
+	}
+	opts.SkipForeign = true
+
+	syxr := sysex.NewReader(r, opts)
+	for {
+		syx, err := syxr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, warning := range syx.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+		if err := enc.Encode(syx); err != nil {
+			return err
+		}
 	}
+}
 
+// runReverse converts every sysex message encoded in r
+// as xml or json back to sysex data and writes it to w.
+// Messages with fields that are missing, unknown, or out of
+// range are rejected.
+func runReverse(r io.Reader, w io.Writer, format string) error {
+	var (
+		all []*sysex.Sysex
+		err error
+	)
 	switch format {
 	default:
 		return fmt.Errorf("Unrecognized format: %s", format)
 	case "xml":
-		return xml.NewEncoder(w).Encode(syx)
+		all, err = sysex.DecodeXML(r)
 	case "json":
-		return json.NewEncoder(w).Encode(syx)
+		all, err = sysex.DecodeJSON(r)
+	}
+	if err != nil {
+		return err
+	}
+	for _, syx := range all {
+		if err := validate(syx); err != nil {
+			return err
+		}
+		if _, err := syx.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the voice or bank of a sysex message.
+func validate(syx *sysex.Sysex) error {
+	switch syx.FormatNumber {
+	case sysex.FormatSingleVoice:
+		if syx.Voice != nil {
+			return syx.Voice.Validate()
+		}
+	case sysex.FormatBank:
+		if syx.Data != nil {
+			return syx.Data.Validate()
+		}
 	}
+	return nil
 }
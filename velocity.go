@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultVelocityCurve is the name of the default velocity curve.
+const defaultVelocityCurve = "linear"
+
+// velocityCurves map names to functions that reshape the
+// velocity (0-127) of a MIDI note, to adapt the response of
+// controllers that play too soft or too hard.
+var velocityCurves = map[string]func(int) int{
+	"linear": func(v int) int { return v },
+	"soft":   func(v int) int { return reshape(v, 0.5) },
+	"hard":   func(v int) int { return reshape(v, 2) },
+	"fixed": func(v int) int {
+		if v > 0 {
+			return 127
+		}
+		return 0
+	},
+}
+
+// reshape raises a velocity (0-127) to a power, keeping 0 and 127 in place.
+// Exponents below 1 make soft notes louder, and exponents above 1
+// make them softer.
+func reshape(v int, exp float64) int {
+	return int(math.Floor(127*math.Pow(float64(v)/127, exp) + 0.5))
+}
+
+// checkVelocityCurve returns an error if there is no velocity curve
+// with a specific name.
+func checkVelocityCurve(name string) error {
+	if _, ok := velocityCurves[name]; ok {
+		return nil
+	}
+	names := make([]string, 0, len(velocityCurves))
+	for name := range velocityCurves {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return errors.Errorf("unknown velocity curve %q (must be one of %s)", name, strings.Join(names, ", "))
+}
+
+// velocity applies the velocity curve to the velocity of a MIDI note.
+func (dx7 *DX7) velocity(v int) int {
+	curve, ok := velocityCurves[dx7.velocityCurve]
+	if !ok {
+		curve = velocityCurves[defaultVelocityCurve]
+	}
+	return curve(v)
+}
+
+// velocityGain returns how much the velocity (0-127) of a note
+// changes the gain of an operator. Operators of the current voice
+// follow their velocity sensitivity, like on the DX7, so velocity
+// changes the timbre as well as the loudness of a voice.
+// Without a voice every operator scales linearly with velocity.
+func (dx7 *DX7) velocityGain(op, velocity int) float32 {
+	if dx7.voice == nil || op > len(dx7.voice.Ops) {
+		return float32(velocity) / 127
+	}
+	return float32(dx7.voice.Ops[op-1].VelocityGain(velocity))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/scgolang/midi"
+)
+
+func TestVelocity(t *testing.T) {
+	dx7 := &DX7{}
+
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 3); err != nil {
+		t.Fatal(err)
+	}
+	dx7.voice.Ops[0].KbdVelocitySensitivity = 0
+	dx7.voice.Ops[1].KbdVelocitySensitivity = 7
+
+	var (
+		soft = dx7.FromNote(midi.Note{Number: 60, Velocity: 20})
+		hard = dx7.FromNote(midi.Note{Number: 60, Velocity: 127})
+	)
+	if expected, got := hard[ctrlName(1, "gain")], soft[ctrlName(1, "gain")]; expected != got {
+		t.Fatalf("expected op1 to ignore velocity, got gain %f and %f", got, expected)
+	}
+	if soft[ctrlName(2, "gain")] >= hard[ctrlName(2, "gain")] {
+		t.Fatal("expected op2 to be quieter for soft notes")
+	}
+	dx7.velocityCurve = "fixed"
+
+	if expected, got := hard[ctrlName(2, "gain")], dx7.FromNote(midi.Note{Number: 60, Velocity: 20})[ctrlName(2, "gain")]; expected != got {
+		t.Fatalf("expected fixed velocity gain %f, got %f", expected, got)
+	}
+}
+
+func TestVelocityCurves(t *testing.T) {
+	for name, curve := range velocityCurves {
+		if err := checkVelocityCurve(name); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := 0, curve(0); expected != got {
+			t.Fatalf("%s: expected %d for velocity 0, got %d", name, expected, got)
+		}
+		if expected, got := 127, curve(127); expected != got {
+			t.Fatalf("%s: expected %d for velocity 127, got %d", name, expected, got)
+		}
+	}
+	if soft, hard := velocityCurves["soft"](64), velocityCurves["hard"](64); soft <= 64 || hard >= 64 {
+		t.Fatalf("expected soft curve above and hard curve below linear, got %d and %d", soft, hard)
+	}
+	if err := checkVelocityCurve("loud"); err == nil {
+		t.Fatal("expected error for unknown velocity curve")
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/dx7/sysex"
+	"github.com/scgolang/sc"
+)
+
+// transposeCenter is the transpose value of a voice that is not transposed.
+const transposeCenter = 24
+
+// LoadVoice applies a DX7 voice to the synth.
+// The algorithm of the voice selects the synthdef that new notes
+// are played with, unless an algorithm was chosen with the
+// -algorithm flag. The operator levels, frequencies and
+// envelopes of the voice replace the synth's ctrls.
+func (dx7 *DX7) LoadVoice(voice *sysex.BulkDump) error {
+	if err := voice.Validate(); err != nil {
+		return errors.Wrap(err, "validating voice")
+	}
+	algorithm := int(voice.Algorithm) + 1
+
+	if _, err := getDefName(algorithm); err != nil {
+		return err
+	}
+	algo := &algorithms[algorithm-1]
+	if dx7.algorithmName != "" {
+		algo = dx7.algorithm
+	}
+	ctrls := pitchEnvCtrls(voice.PitchEG.PitchSegments())
+	ctrls["feedback"] = float32(sysex.FeedbackIndex(voice.Feedback))
+	for param, val := range lfoCtrls(voice.LFO) {
+		ctrls[param] = val
+	}
+
+	for i, op := range voice.Ops {
+		var (
+			n    = i + 1
+			segs = op.AmpEG.Segments(0)
+		)
+		ctrls[ctrlName(n, "gain")] = float32(op.Gain())
+		ctrls[ctrlName(n, "amt")] = float32(sysex.MaxModIndex)
+		ctrls[ctrlName(n, "freqscale")] = 1
+		ctrls[ctrlName(n, "fixed")] = float32(op.Oscillator.Mode)
+		ctrls[ctrlName(n, "ams")] = float32(sysex.AmpModRange(op.AmpModSensitivity))
+		for param, val := range envCtrls(segs) {
+			ctrls[ctrlName(n, param)] = val
+		}
+	}
+	for _, param := range performanceCtrls {
+		if val, ok := dx7.ctrls[param]; ok {
+			ctrls[param] = val
+		}
+	}
+	dx7.algorithm = algo
+	dx7.ctrls = ctrls
+	dx7.voice = voice
+
+	logger.Printf("loaded voice %q (algorithm %s)\n", voice.Name, algo.Name)
+
+	return nil
+}
+
+// LoadFile loads a voice from a sysex file.
+// The file may contain a single voice dump, or a bank dump
+// in which case index selects the voice (0-31).
+func (dx7 *DX7) LoadFile(path string, index int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening sysex file")
+	}
+	defer func() { _ = f.Close() }()
+
+	syx, err := sysex.New(f)
+	if err != nil {
+		return errors.Wrap(err, "reading sysex file")
+	}
+	voice := syx.Voice
+	if syx.Data != nil {
+		if index < 0 || index >= len(syx.Data) {
+			return errors.Errorf("voice index %d out of range [0, %d]", index, len(syx.Data)-1)
+		}
+		voice = syx.Data[index]
+	}
+	if voice == nil {
+		return errors.New("sysex file does not contain a voice")
+	}
+	if err := dx7.LoadVoice(voice); err != nil {
+		return err
+	}
+	dx7.bank = syx.Data
+
+	return nil
+}
+
+// yamahaID is the manufacturer ID of Yamaha sysex messages.
+const yamahaID = 0x43
+
+// LoadSysex loads a DX7 bulk dump that was received over MIDI.
+// A single voice dump replaces the current voice, and a bank dump
+// replaces the bank that program changes select voices from, like
+// on the DX7. Sysex messages that are not bulk dumps are ignored.
+// A dump with a bad checksum is rejected with an error, and the
+// current voice and bank are kept.
+func (dx7 *DX7) LoadSysex(msg []byte) error {
+	// The substatus of a bulk dump is 0.
+	if len(msg) < 3 || msg[1] != yamahaID || msg[2]>>4 != 0 {
+		return nil
+	}
+	syx, err := sysex.New(bytes.NewReader(msg))
+	if err != nil {
+		return errors.Wrap(err, "receiving bulk dump")
+	}
+	if syx.Voice != nil {
+		return dx7.LoadVoice(syx.Voice)
+	}
+	if err := syx.Data.Validate(); err != nil {
+		return errors.Wrap(err, "validating bank")
+	}
+	dx7.bank = syx.Data
+
+	logger.Printf("loaded bank (%d voices)\n", len(syx.Data))
+
+	return nil
+}
+
+// transposed applies the transpose of the current voice to a MIDI note.
+func (dx7 *DX7) transposed(note int) int {
+	if dx7.voice != nil {
+		note += int(dx7.voice.Transpose) - transposeCenter
+	}
+	return note
+}
+
+// noteFreq returns the frequency of a MIDI note after
+// applying the transpose of the current voice.
+func (dx7 *DX7) noteFreq(note int) float64 {
+	return float64(sc.Midicps(float32(dx7.transposed(note))))
+}
+
+// opFreq returns the frequency an operator plays for a
+// note frequency, following the oscillator settings of the
+// current voice.
+func (dx7 *DX7) opFreq(op int, freq float64) float64 {
+	if dx7.voice == nil || op > len(dx7.voice.Ops) {
+		return freq
+	}
+	return dx7.voice.Ops[op-1].Oscillator.Freq(freq)
+}
+
+// oscPhase returns the phase (0-1) an oscillator playing a
+// frequency starts at when a note is played after a duration.
+// With osc key sync every note starts its oscillators at phase 0,
+// otherwise they start where they would be if they had been
+// running since the DX7 started, like the free running
+// oscillators of the DX7.
+func (dx7 *DX7) oscPhase(freq float64, elapsed time.Duration) float32 {
+	if dx7.voice == nil {
+		return 0
+	}
+	return phaseAt(dx7.voice.OscKeySync, freq, elapsed)
+}
+
+// phaseAt returns the phase (0-1) of an oscillator with a
+// frequency after a duration, or 0 if sync is 1.
+func phaseAt(sync int8, freq float64, elapsed time.Duration) float32 {
+	if sync == 1 {
+		return 0
+	}
+	_, phase := math.Modf(freq * elapsed.Seconds())
+	return float32(phase)
+}
+
+// keyScaling applies the keyboard level scaling and keyboard
+// rate scaling of an operator of the current voice to the
+// gain and envelope times in ctrls for a MIDI note.
+// Scaling the ctrls keeps any changes made to them by MIDI CCs.
+func (dx7 *DX7) keyScaling(ctrls map[string]float32, op, note int) {
+	if dx7.voice == nil || op > len(dx7.voice.Ops) {
+		return
+	}
+	var (
+		o   = dx7.voice.Ops[op-1]
+		key = dx7.transposed(note)
+	)
+	if gain := o.Gain(); gain > 0 {
+		ctrls[ctrlName(op, "gain")] *= float32(o.ScaledGain(key) / gain)
+	}
+	rateScaling := o.RateScaling(key)
+	if rateScaling == 0 {
+		return
+	}
+	var (
+		segs   = o.AmpEG.Segments(0)
+		scaled = o.AmpEG.Segments(rateScaling)
+	)
+	for i, seg := range segs {
+		if seg.Time > 0 {
+			ctrls[ctrlName(op, "t"+strconv.Itoa(i+1))] *= float32(scaled[i].Time / seg.Time)
+		}
+	}
+}
+
+// envCtrls returns the values of the amp envelope params
+// of an operator for the segments of a DX7 EG.
+func envCtrls(segs [numEGSegments]sysex.EGSegment) map[string]float32 {
+	ctrls := map[string]float32{"l0": float32(segs[0].From)}
+
+	for i, seg := range segs {
+		n := strconv.Itoa(i + 1)
+		ctrls["l"+n] = float32(seg.To)
+		ctrls["t"+n] = float32(seg.Time)
+		ctrls["c"+n] = float32(-math.Log(seg.Speedup))
+	}
+	return ctrls
+}
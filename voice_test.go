@@ -0,0 +1,228 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/scgolang/dx7/sysex"
+	"github.com/scgolang/midi"
+)
+
+func init() {
+	logger = log.New(ioutil.Discard, "", 0)
+}
+
+func TestLoadFile(t *testing.T) {
+	dx7 := &DX7{}
+
+	// STRINGS 1 uses algorithm 2.
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 3); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "STRINGS 1 ", dx7.voice.Name; expected != got {
+		t.Fatalf("expected voice %q, got %q", expected, got)
+	}
+	if expected, got := "2", dx7.algorithm.Name; expected != got {
+		t.Fatalf("expected algorithm %s, got %s", expected, got)
+	}
+	for i, op := range dx7.voice.Ops {
+		n := i + 1
+		if expected, got := float32(op.Gain()), dx7.ctrls[ctrlName(n, "gain")]; expected != got {
+			t.Fatalf("op%d: expected gain %f, got %f", n, expected, got)
+		}
+		if expected, got := float32(op.AmpEG.Times()[0]), dx7.ctrls[ctrlName(n, "t1")]; expected != got {
+			t.Fatalf("op%d: expected attack time %f, got %f", n, expected, got)
+		}
+		if expected, got := float32(sysex.EGLevelDB(op.AmpEG.L3)), dx7.ctrls[ctrlName(n, "l3")]; expected != got {
+			t.Fatalf("op%d: expected sustain level %f, got %f", n, expected, got)
+		}
+	}
+	ctrls := dx7.FromNote(midi.Note{Number: 69, Velocity: 127})
+
+	if expected, got := float32(sysex.FeedbackIndex(dx7.voice.Feedback)), ctrls["feedback"]; expected != got {
+		t.Fatalf("expected feedback %f, got %f", expected, got)
+	}
+	lfo := dx7.voice.LFO
+	if expected, got := float32(lfo.Freq()), ctrls["lfofreq"]; expected != got {
+		t.Fatalf("expected lfo freq %f, got %f", expected, got)
+	}
+	if expected, got := float32(sysex.PitchModRange(lfo.PMSensitivity)), ctrls["pms"]; expected != got {
+		t.Fatalf("expected pitch mod range %f, got %f", expected, got)
+	}
+	if lfo.Sync == 1 && ctrls["lfophase"] != 0 {
+		t.Fatalf("expected lfo phase 0 with key sync, got %f", ctrls["lfophase"])
+	}
+	pitchSegs := dx7.voice.PitchEG.PitchSegments()
+	if expected, got := float32(pitchSegs[0].To*12), ctrls["pl1"]; expected != got {
+		t.Fatalf("expected pitch level %f, got %f", expected, got)
+	}
+	if expected, got := float32(pitchSegs[3].Time), ctrls["pt4"]; expected != got {
+		t.Fatalf("expected pitch time %f, got %f", expected, got)
+	}
+
+	for i, op := range dx7.voice.Ops {
+		var (
+			n        = i + 1
+			expected = op.Oscillator.Freq(440)
+			got      = float64(ctrls[ctrlName(n, "freq")])
+		)
+		if math.Abs(expected-got) > 1e-3 {
+			t.Fatalf("op%d: expected freq %f, got %f", n, expected, got)
+		}
+		if expected, got := dx7.ctrls[ctrlName(n, "gain")]*float32(op.VelocityGain(127)), ctrls[ctrlName(n, "gain")]; expected != got {
+			t.Fatalf("op%d: expected gain %f, got %f", n, expected, got)
+		}
+		if expected, got := float32(sysex.AmpModRange(op.AmpModSensitivity)), ctrls[ctrlName(n, "ams")]; expected != got {
+			t.Fatalf("op%d: expected amp mod sensitivity %f, got %f", n, expected, got)
+		}
+	}
+}
+
+func TestModWheel(t *testing.T) {
+	dx7 := &DX7{}
+
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 3); err != nil {
+		t.Fatal(err)
+	}
+	dx7.FromCtrl(midi.CC{Number: 1, Value: 127})
+
+	if expected, got := float32(1), dx7.FromNote(midi.Note{Number: 60, Velocity: 100})["modwheel"]; expected != got {
+		t.Fatalf("expected mod wheel %f, got %f", expected, got)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	dx7 := &DX7{}
+
+	// Every operator of E.PIANO 1 has L3 equal to L4.
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 10); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "E.PIANO 1 ", dx7.voice.Name; expected != got {
+		t.Fatalf("expected voice %q, got %q", expected, got)
+	}
+	for i, op := range dx7.voice.Ops {
+		n := i + 1
+		if op.AmpEG.L3 != op.AmpEG.L4 || op.AmpEG.L1 == op.AmpEG.L4 {
+			continue
+		}
+		if got := dx7.ctrls[ctrlName(n, "t4")]; got <= 0 {
+			t.Fatalf("op%d: expected a release time with L3 equal to L4, got %f", n, got)
+		}
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	dx7 := &DX7{}
+
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 32); err == nil {
+		t.Fatal("expected error for voice index out of range")
+	}
+	if err := dx7.LoadFile("assets/syx/nonexistent.syx", 0); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestLoadVoiceInvalid(t *testing.T) {
+	dx7 := &DX7{}
+
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 3); err != nil {
+		t.Fatal(err)
+	}
+	voice := *dx7.voice
+	voice.Feedback = 8
+
+	if err := dx7.LoadVoice(&voice); err == nil {
+		t.Fatal("expected error for out of range feedback")
+	}
+	if expected, got := "STRINGS 1 ", dx7.voice.Name; expected != got {
+		t.Fatalf("expected voice %q to stay loaded, got %q", expected, got)
+	}
+}
+
+func TestKeyScaling(t *testing.T) {
+	dx7 := &DX7{}
+
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 3); err != nil {
+		t.Fatal(err)
+	}
+	op := dx7.voice.Ops[0]
+	op.KbdRateScaling = 7
+	op.KbdLevelScaling = sysex.KbdLevelScaling{Breakpoint: 39, Rdepth: 99, Rcurve: 0}
+
+	var (
+		key  = 60 + transposeCenter - int(dx7.voice.Transpose)
+		low  = dx7.FromNote(midi.Note{Number: key, Velocity: 127})
+		high = dx7.FromNote(midi.Note{Number: key + 24, Velocity: 127})
+	)
+	velocity := float32(op.VelocityGain(127))
+
+	if expected, got := float32(op.Gain())*velocity, low[ctrlName(1, "gain")]; expected != got {
+		t.Fatalf("expected gain %f at the breakpoint, got %f", expected, got)
+	}
+	if expected, got := float32(op.ScaledGain(84))*velocity, high[ctrlName(1, "gain")]; expected != got {
+		t.Fatalf("expected scaled gain %f, got %f", expected, got)
+	}
+	if expected, got := float32(op.AmpEG.Segments(op.RateScaling(84))[0].Time), high[ctrlName(1, "t1")]; math.Abs(float64(expected-got)) > 1e-6 {
+		t.Fatalf("expected attack time %f, got %f", expected, got)
+	}
+	if low[ctrlName(1, "t2")] <= high[ctrlName(1, "t2")] {
+		t.Fatal("expected rate scaling to shorten the envelope of high notes")
+	}
+}
+
+func TestFixedFreq(t *testing.T) {
+	dx7 := &DX7{}
+
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 3); err != nil {
+		t.Fatal(err)
+	}
+	voice := *dx7.voice
+	voice.Ops = append([]*sysex.Op{}, voice.Ops...)
+	op := *voice.Ops[1]
+	op.Oscillator = sysex.Oscillator{Mode: 1, FreqCoarse: 2, FreqFine: 0, Detune: 7}
+	voice.Ops[1] = &op
+
+	if err := dx7.LoadVoice(&voice); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := float32(1), dx7.ctrls[ctrlName(2, "fixed")]; expected != got {
+		t.Fatalf("expected fixed mode %f, got %f", expected, got)
+	}
+	if expected, got := float32(0), dx7.ctrls[ctrlName(1, "fixed")]; expected != got {
+		t.Fatalf("expected tracking mode %f, got %f", expected, got)
+	}
+	for _, note := range []int{36, 60, 84} {
+		ctrls := dx7.FromNote(midi.Note{Number: note, Velocity: 100})
+		if expected, got := float32(100), ctrls[ctrlName(2, "freq")]; math.Abs(float64(expected-got)) > 1e-3 {
+			t.Fatalf("note %d: expected fixed freq %f, got %f", note, expected, got)
+		}
+	}
+}
+
+func TestOscKeySync(t *testing.T) {
+	dx7 := &DX7{}
+
+	if err := dx7.LoadFile("assets/syx/rom1a.syx", 3); err != nil {
+		t.Fatal(err)
+	}
+	dx7.voice.OscKeySync = 1
+
+	ctrls := dx7.FromNote(midi.Note{Number: 60, Velocity: 100})
+	for op := 1; op <= numOps; op++ {
+		if expected, got := float32(0), ctrls[ctrlName(op, "phase")]; expected != got {
+			t.Fatalf("op%d: expected phase %f with key sync, got %f", op, expected, got)
+		}
+	}
+	dx7.voice.OscKeySync = 0
+
+	if expected, got := float32(0.25), dx7.oscPhase(440, 2*time.Second+time.Second/1760); math.Abs(float64(expected-got)) > 1e-6 {
+		t.Fatalf("expected free running phase %f, got %f", expected, got)
+	}
+	if expected, got := float32(0.5), phaseAt(0, 1, 1500*time.Millisecond); expected != got {
+		t.Fatalf("expected phase %f, got %f", expected, got)
+	}
+}
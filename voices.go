@@ -0,0 +1,234 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+const (
+	// defaultPolyphony is the number of notes the DX7 plays at once.
+	defaultPolyphony = 16
+
+	// stealRelease is the release time (in secs) of a stolen note.
+	// It is short enough to free the node quickly, but long enough
+	// to avoid a click.
+	stealRelease = 0.005
+)
+
+// Ways to choose the note that is stolen when all voices are playing.
+const (
+	// stealOldest steals the note that started first.
+	stealOldest = "oldest"
+
+	// stealQuietest steals a released note if there is one,
+	// otherwise the note that was played the softest.
+	stealQuietest = "quietest"
+)
+
+// server creates and controls synth nodes.
+// It is implemented by *sc.Client.
+type server interface {
+	NextSynthID() int32
+	NodeSet(id int32, ctls map[string]float32) error
+	Synth(defName string, id, action, target int32, ctls map[string]float32) (*sc.Synth, error)
+}
+
+// node is a synth node that plays a note.
+type node struct {
+	id       int32
+	note     int
+	velocity int
+	start    uint64
+
+	// released is set when the note is released, and end is
+	// when the synth frees itself.
+	released bool
+	end      time.Time
+
+	// releases are the release times (t4) of the operators.
+	releases map[string]float32
+}
+
+// voices plays notes with synth nodes.
+// It plays at most polyphony notes at once, and steals a note
+// to play a new one when all voices are playing.
+// Released notes keep their voice until their synth frees itself.
+type voices struct {
+	server    server
+	group     int32
+	polyphony int
+	steal     string
+	now       func() time.Time
+
+	nodes []*node
+	count uint64
+}
+
+// newVoices creates voices that add synth nodes to a group.
+func newVoices(server server, group int32, polyphony int, steal string) *voices {
+	return &voices{
+		server:    server,
+		group:     group,
+		polyphony: polyphony,
+		steal:     steal,
+		now:       time.Now,
+	}
+}
+
+// NoteOn starts a synth node that plays a note.
+// If the note is already playing it is released first.
+func (v *voices) NoteOn(note, velocity int, def string, ctrls map[string]float32) error {
+	if err := v.NoteOff(note); err != nil {
+		return err
+	}
+	v.expire()
+
+	for len(v.nodes) >= v.polyphony {
+		if err := v.stealNode(); err != nil {
+			return err
+		}
+	}
+	id := v.server.NextSynthID()
+	if _, err := v.server.Synth(def, id, sc.AddToTail, v.group, ctrls); err != nil {
+		return errors.Wrapf(err, "playing note %d", note)
+	}
+	v.count++
+	v.nodes = append(v.nodes, &node{
+		id:       id,
+		note:     note,
+		velocity: velocity,
+		start:    v.count,
+		releases: releaseCtrls(ctrls),
+	})
+	return nil
+}
+
+// NoteOff releases a note.
+func (v *voices) NoteOff(note int) error {
+	for _, n := range v.nodes {
+		if n.note != note || n.released {
+			continue
+		}
+		n.released = true
+		n.end = v.now().Add(releaseTime(n.releases))
+
+		if err := v.server.NodeSet(n.id, map[string]float32{"gate": 0}); err != nil {
+			return errors.Wrapf(err, "releasing note %d", note)
+		}
+	}
+	return nil
+}
+
+// Set sets ctrls of all the notes that are playing.
+// The release times of the notes that are held are updated, since
+// they change when their synths free themselves.
+func (v *voices) Set(ctrls map[string]float32) error {
+	for _, n := range v.nodes {
+		if !n.released {
+			for param := range n.releases {
+				if t, ok := ctrls[param]; ok {
+					n.releases[param] = t
+				}
+			}
+		}
+		if err := v.server.NodeSet(n.id, ctrls); err != nil {
+			return errors.Wrapf(err, "setting ctrls of note %d", n.note)
+		}
+	}
+	return nil
+}
+
+// expire forgets the released notes whose synths have freed themselves.
+func (v *voices) expire() {
+	var (
+		now   = v.now()
+		nodes = v.nodes[:0]
+	)
+	for _, n := range v.nodes {
+		if !n.released || now.Before(n.end) {
+			nodes = append(nodes, n)
+		}
+	}
+	v.nodes = nodes
+}
+
+// stealNode releases a note quickly to free its voice.
+// A gate below -1 makes the envelope release in -1-gate secs.
+func (v *voices) stealNode() error {
+	i := v.victim()
+	n := v.nodes[i]
+	v.nodes = append(v.nodes[:i], v.nodes[i+1:]...)
+
+	if err := v.server.NodeSet(n.id, map[string]float32{"gate": -1 - stealRelease}); err != nil {
+		return errors.Wrapf(err, "stealing note %d", n.note)
+	}
+	return nil
+}
+
+// victim returns the index of the node that is stolen.
+func (v *voices) victim() int {
+	victim := 0
+	for i, n := range v.nodes[1:] {
+		if v.quieter(n, v.nodes[victim]) {
+			victim = i + 1
+		}
+	}
+	return victim
+}
+
+// quieter reports whether a node should be stolen before another one.
+func (v *voices) quieter(a, b *node) bool {
+	if v.steal == stealQuietest {
+		if a.released != b.released {
+			return a.released
+		}
+		if a.velocity != b.velocity {
+			return a.velocity < b.velocity
+		}
+	}
+	return a.start < b.start
+}
+
+// releaseCtrls returns the release times (t4) of the operators
+// in the ctrls of a note.
+func releaseCtrls(ctrls map[string]float32) map[string]float32 {
+	releases := map[string]float32{}
+	for op := 1; ; op++ {
+		param := ctrlName(op, "t4")
+		t, ok := ctrls[param]
+		if !ok {
+			return releases
+		}
+		releases[param] = t
+	}
+}
+
+// releaseTime returns how long a synth plays after its gate closes.
+// The envelope of every operator releases in its t4, and the synth
+// frees itself once all of them are done (see freeWhenDone), so
+// this is the longest release time of the operators in ctrls.
+func releaseTime(ctrls map[string]float32) time.Duration {
+	var release float32
+	for op := 1; ; op++ {
+		t, ok := ctrls[ctrlName(op, "t4")]
+		if !ok {
+			break
+		}
+		if t > release {
+			release = t
+		}
+	}
+	return time.Duration(float64(release) * float64(time.Second))
+}
+
+// checkSteal returns an error if there is no way to steal notes
+// with a specific name.
+func checkSteal(steal string) error {
+	switch steal {
+	case stealOldest, stealQuietest:
+		return nil
+	}
+	return errors.Errorf("unknown voice stealing %q (must be %s or %s)", steal, stealOldest, stealQuietest)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scgolang/midi"
+)
+
+// playing returns the notes of the nodes that are neither
+// released nor stolen, in the order they started.
+func playing(v *voices) []int {
+	notes := []int{}
+	for _, n := range v.nodes {
+		if !n.released {
+			notes = append(notes, n.note)
+		}
+	}
+	return notes
+}
+
+func TestVoicesSteal(t *testing.T) {
+	for _, testcase := range []struct {
+		steal  string
+		stolen int
+	}{
+		{stealOldest, 60},
+		{stealQuietest, 64},
+	} {
+		var (
+			server = newFakeServer()
+			v      = newVoices(server, defaultGroupID, 3, testcase.steal)
+			ctrls  = map[string]float32{ctrlName(1, "t4"): 1}
+		)
+		for i, velocity := range []int{100, 90, 20} {
+			if err := v.NoteOn(60+i*2, velocity, "dx7_algo1", ctrls); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := v.NoteOn(72, 100, "dx7_algo1", ctrls); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := 3, len(v.nodes); expected != got {
+			t.Fatalf("%s: expected %d nodes, got %d", testcase.steal, expected, got)
+		}
+		for _, note := range playing(v) {
+			if note == testcase.stolen {
+				t.Fatalf("%s: expected note %d to be stolen", testcase.steal, note)
+			}
+		}
+		var stolen int
+		for id, ctrls := range server.ctrls {
+			if ctrls["gate"] < -1 {
+				stolen++
+				if expected, got := float32(-1-stealRelease), ctrls["gate"]; expected != got {
+					t.Fatalf("%s: expected node %d to release with gate %f, got %f", testcase.steal, id, expected, got)
+				}
+			}
+		}
+		if expected, got := 1, stolen; expected != got {
+			t.Fatalf("%s: expected %d stolen nodes, got %d", testcase.steal, expected, got)
+		}
+	}
+}
+
+func TestVoicesRelease(t *testing.T) {
+	var (
+		server = newFakeServer()
+		v      = newVoices(server, defaultGroupID, 2, stealQuietest)
+		now    = time.Now()
+		ctrls  = map[string]float32{ctrlName(1, "t4"): 0.5, ctrlName(2, "t4"): 2}
+	)
+	v.now = func() time.Time { return now }
+
+	if expected, got := 2*time.Second, releaseTime(ctrls); expected != got {
+		t.Fatalf("expected release time %s, got %s", expected, got)
+	}
+	for _, note := range []int{60, 64} {
+		if err := v.NoteOn(note, 10, "dx7_algo1", ctrls); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.NoteOff(64); err != nil {
+		t.Fatal(err)
+	}
+	// The quietest note is the one that is released.
+	if err := v.NoteOn(67, 100, "dx7_algo1", ctrls); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := []int{60, 67}, playing(v); len(got) != 2 || got[0] != expected[0] || got[1] != expected[1] {
+		t.Fatalf("expected notes %v, got %v", expected, got)
+	}
+	// Notes whose release has finished do not take a voice.
+	if err := v.NoteOff(60); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(3 * time.Second)
+
+	if err := v.NoteOn(69, 100, "dx7_algo1", ctrls); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, len(v.nodes); expected != got {
+		t.Fatalf("expected %d nodes, got %d", expected, got)
+	}
+	var stolen int
+	for _, ctrls := range server.ctrls {
+		if ctrls["gate"] < -1 {
+			stolen++
+		}
+	}
+	if expected, got := 1, stolen; expected != got {
+		t.Fatalf("expected %d stolen note, got %d", expected, got)
+	}
+}
+
+func TestVoicesSetRelease(t *testing.T) {
+	var (
+		server = newFakeServer()
+		v      = newVoices(server, defaultGroupID, 2, stealOldest)
+		now    = time.Now()
+		ctrls  = map[string]float32{ctrlName(1, "t4"): 0.5, ctrlName(2, "t4"): 1}
+	)
+	v.now = func() time.Time { return now }
+
+	if err := v.NoteOn(60, 100, "dx7_algo1", ctrls); err != nil {
+		t.Fatal(err)
+	}
+	// Changing the ctrls of the note does not change the ctrls it started with.
+	if err := v.Set(map[string]float32{ctrlName(2, "t4"): 4}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := float32(1), ctrls[ctrlName(2, "t4")]; expected != got {
+		t.Fatalf("expected t4 %f, got %f", expected, got)
+	}
+	if err := v.NoteOff(60); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := now.Add(4*time.Second), v.nodes[0].end; !expected.Equal(got) {
+		t.Fatalf("expected the note to end at %s, got %s", expected, got)
+	}
+	// A released note keeps the release it started.
+	if err := v.Set(map[string]float32{ctrlName(2, "t4"): 8}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := float32(4), v.nodes[0].releases[ctrlName(2, "t4")]; expected != got {
+		t.Fatalf("expected t4 %f, got %f", expected, got)
+	}
+}
+
+func TestPolyphonyAmp(t *testing.T) {
+	dx7 := &DX7{polyphony: 8}
+
+	if expected, got := float32(1.0/8), dx7.FromNote(midi.Note{Number: 60, Velocity: 100})["amp"]; expected != got {
+		t.Fatalf("expected amp %f, got %f", expected, got)
+	}
+}